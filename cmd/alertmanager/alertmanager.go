@@ -1,52 +1,59 @@
 package main
 
 import (
+	"ArchiD-Projet/internal/airports"
+	"ArchiD-Projet/internal/alerts"
 	"ArchiD-Projet/internal/brokerConfiguration"
 	"ArchiD-Projet/internal/brokerUtils"
 	"ArchiD-Projet/internal/mqttconnect"
+	"ArchiD-Projet/internal/notifications"
+	"ArchiD-Projet/internal/recordings"
+	"ArchiD-Projet/internal/thresholds"
+	"flag"
 	"fmt"
-	mqtt "github.com/eclipse/paho.mqtt.golang"
 	"gopkg.in/yaml.v3"
 	"io"
 	"log"
 	"os"
 	"strconv"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 )
 
 type Thresholds struct {
-	Temp struct {
-		Min float64 `yaml:"min"`
-		Max float64 `yaml:"max"`
-	} `yaml:"temp"`
+	Temp thresholds.SeasonalBounds `yaml:"temp"`
 	Wind struct {
-		Speed float64 `yaml:"speed"`
+		Speed    float64 `yaml:"speed"`
+		Severity string  `yaml:"severity"`
 	} `yaml:"wind"`
-	Pressure struct {
-		Summer struct {
-			Min float64 `yaml:"min"`
-			Max float64 `yaml:"max"`
-		} `yaml:"summer"`
-		Winter struct {
-			Min float64 `yaml:"min"`
-			Max float64 `yaml:"max"`
-		} `yaml:"winter"`
-	} `yaml:"pressure"`
+	Pressure     thresholds.SeasonalBounds `yaml:"pressure"`
+	RateOfChange []RateOfChangeRule        `yaml:"rateOfChange"`
+	Composite    []CompositeRule           `yaml:"composite"`
+	Watchdog     WatchdogConfig            `yaml:"watchdog"`
+	Anomaly      AnomalyConfig             `yaml:"anomaly"`
+	Incidents    IncidentConfig            `yaml:"incidents"`
 }
 
 var topics = brokerconfiguration.GetAlertManagerTopics()
 
 var (
-	BROKER      = brokerconfiguration.GetBrokerAddress()
-	TOPIC       = topics[0]
-	ALERT_TOPIC = topics[1]
+	BROKER        = brokerconfiguration.GetBrokerAddress()
+	TOPIC         = topics[0]
+	ALERT_TOPIC   = topics[1]
+	COMMAND_TOPIC = topics[2]
+	STATE_TOPIC   = topics[3]
+	RUNWAY_TOPIC  = topics[4]
+	LEADER_TOPIC  = topics[5]
+	settings      = brokerconfiguration.GetAlertManagerSettings()
+	// Sensors publish their timestamps in UTC+1
+	sensorZone = time.FixedZone("UTC+1", 60*60)
 )
 
-func getThresholds() (Thresholds, error) {
-	yamlFile, err := os.Open("config/threshold_config.yml")
+func loadThresholds(filename string) (Thresholds, error) {
+	yamlFile, err := os.Open(filename)
 	if err != nil {
-		log.Fatal("Error opening threshold configuration file:", err)
 		return Thresholds{}, err
 	}
 	defer yamlFile.Close()
@@ -57,42 +64,131 @@ func getThresholds() (Thresholds, error) {
 
 	err = yaml.Unmarshal(byteValue, &thresholds)
 	if err != nil {
-		log.Fatal("Error unmarshalling YAML:", err)
 		return Thresholds{}, err
 	}
 
 	return thresholds, nil
 }
 
-func getAlertTopicFromMessageTopic(topic string) string {
-	return ALERT_TOPIC + brokerutils.GetAirportCodeFromTopic(topic)
+// alertManager raises the alerts of the readings in its state, publishes them and
+// notifies the sinks. The service runs one, the backtest and the tests their own.
+type alertManager struct {
+	state       *alertState
+	publisher   publisher
+	dispatcher  *notifications.Dispatcher
+	airportInfo *airports.Config
+	// A nil election makes the manager always the leader
+	election   *leaderElection
+	thresholds atomic.Value
+	// Series windows by airport
+	windows      map[string]*airportWindows
+	windowsMutex sync.RWMutex
+	// Latest data of every series, checked by the watchdog
+	activity      map[string]*seriesActivity
+	activityMutex sync.Mutex
+	// Anomaly detection baselines by series
+	anomalies    map[string]*anomalySeries
+	anomalyMutex sync.Mutex
+	statePending chan struct{}
+	// Escalations by alert ID, only used by the escalation loop
+	escalations map[string]*escalation
 }
 
-func getSeasonFromTimestamp(timestamp string) string {
-	t, err := time.Parse("2006-01-02 15:04:05", timestamp)
-	if err != nil {
-		log.Println("Error parsing timestamp:", err)
-		return ""
+func newAlertManager(state *alertState, publisher publisher, dispatcher *notifications.Dispatcher, airportInfo *airports.Config, election *leaderElection) *alertManager {
+	return &alertManager{
+		state:        state,
+		publisher:    publisher,
+		dispatcher:   dispatcher,
+		airportInfo:  airportInfo,
+		election:     election,
+		windows:      make(map[string]*airportWindows),
+		activity:     make(map[string]*seriesActivity),
+		anomalies:    make(map[string]*anomalySeries),
+		statePending: make(chan struct{}, 1),
+		escalations:  make(map[string]*escalation),
 	}
+}
+
+func (m *alertManager) getThresholds() Thresholds {
+	return m.thresholds.Load().(Thresholds)
+}
 
-	month := t.Month()
+// reloadThresholds picks up edits of the threshold file, a file that cannot be loaded
+// keeps the previous thresholds in use.
+func (m *alertManager) reloadThresholds(filename string, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
 
-	if month >= 3 && month <= 9 {
-		return "summer"
+	for range ticker.C {
+		thresholds, err := loadThresholds(filename)
+		if err != nil {
+			log.Println("Error reloading thresholds:", err)
+			continue
+		}
+		m.thresholds.Store(thresholds)
+		m.state.configureIncidents(thresholds.Incidents)
+	}
+}
+
+func (m *alertManager) updateAlert(alert alerts.Alert, firing bool) {
+	if firing {
+		m.raiseAlert(alert)
 	} else {
-		return "winter"
+		m.resolveAlert(alert)
 	}
 }
 
-func onMessageReceived(client mqtt.Client, message mqtt.Message) {
-	thresholds, err := getThresholds()
-	if err != nil {
-		log.Println("Error getting thresholds:", err)
+func (m *alertManager) raiseAlert(alert alerts.Alert) {
+	if alert.Severity == "" {
+		alert.Severity = alerts.SeverityWarning
+	}
+
+	// Silenced and acknowledged alerts are kept in the history but not notified
+	alert, notify := m.state.fire(alert, time.Now())
+	m.publishState()
+
+	if !notify {
+		return
+	}
+	m.notifyAlert(alert)
+}
+
+func (m *alertManager) resolveAlert(alert alerts.Alert) {
+	resolved, ok := m.state.resolve(alert)
+	if !ok {
 		return
 	}
+	m.publishState()
+
+	if resolved.Silenced {
+		return
+	}
+	resolved.Message = fmt.Sprintf("Resolved: %s for %s (%f)", resolved.Rule, resolved.Airport, resolved.Value)
+	m.notifyAlert(resolved)
+}
+
+// notifyAlert publishes an alert on its airport topic. The sinks are notified of the
+// alert itself or, when alerts are grouped, of the changes of its incident.
+func (m *alertManager) notifyAlert(alert alerts.Alert) {
+	topic := ALERT_TOPIC + alert.Airport
+	m.publisher.PublishAsync(topic, 1, false, alert.Message, onPublishError(topic))
+
+	if alert.IncidentID != "" {
+		m.notifyIncidents(time.Now())
+		return
+	}
+	m.dispatchNotification(alert, []alerts.Alert{alert})
+}
+
+func (m *alertManager) processMessage(topic string, body []byte) {
+	thresholds := m.getThresholds()
 
-	payload := string(message.Payload())
+	payload := string(body)
 	data := strings.Split(payload, " ")
+	if len(data) != 4 {
+		log.Printf("Malformed message on %s dropped: %q\n", topic, payload)
+		return
+	}
 
 	submittedTimestamp := data[0] + " " + data[1]
 	sensor := data[2]
@@ -102,54 +198,214 @@ func onMessageReceived(client mqtt.Client, message mqtt.Message) {
 		return
 	}
 
+	timestamp, err := time.ParseInLocation("2006-01-02 15:04:05", submittedTimestamp, sensorZone)
+	if err != nil {
+		log.Println("Failed to parse timestamp:", err)
+		return
+	}
+
+	alert := alerts.Alert{
+		Airport:     brokerutils.GetAirportCodeFromTopic(topic),
+		Measurement: sensor,
+		Rule:        sensor,
+		Value:       value,
+		Time:        timestamp,
+	}
+
+	m.recordActivity(alert, time.Now())
+	m.checkSeriesRules(alert, thresholds)
+
+	season := m.airportInfo.Season(alert.Airport, timestamp)
+
 	switch sensor {
 	case "temperature":
-		if value < thresholds.Temp.Min || value > thresholds.Temp.Max {
-			alertMessage := fmt.Sprintf("Alert: Temperature (%f) exceeded threshold (%f-%f)", value, thresholds.Temp.Min, thresholds.Temp.Max)
-			token := client.Publish(getAlertTopicFromMessageTopic(message.Topic()), 1, false, alertMessage)
-			token.Wait()
+		bounds, ok := thresholds.Temp.ForSeason(season)
+		if !ok {
+			log.Printf("No temperature threshold for season %q at %s\n", season, alert.Airport)
+			return
 		}
+
+		alert.Severity = thresholds.Temp.Severity
+		alert.Message = fmt.Sprintf("Alert: Temperature (%f) exceeded threshold (%f-%f)", value, bounds.Min, bounds.Max)
+		m.updateAlert(alert, value < bounds.Min || value > bounds.Max)
 	case "pressure":
-		season := getSeasonFromTimestamp(submittedTimestamp)
-		var minThreshold, maxThreshold float64
-		if season == "summer" {
-			minThreshold, maxThreshold = thresholds.Pressure.Summer.Min, thresholds.Pressure.Summer.Max
-		} else if season == "winter" {
-			minThreshold, maxThreshold = thresholds.Pressure.Winter.Min, thresholds.Pressure.Winter.Max
-		} else {
-			log.Println("Error getting season from timestamp")
+		bounds, ok := thresholds.Pressure.ForSeason(season)
+		if !ok {
+			log.Printf("No pressure threshold for season %q at %s\n", season, alert.Airport)
 			return
 		}
 
-		if value < minThreshold || value > maxThreshold {
-			alertMessage := fmt.Sprintf("Alert: Pressure (%f) exceeded threshold (%f-%f)", value, minThreshold, maxThreshold)
-			token := client.Publish(getAlertTopicFromMessageTopic(message.Topic()), 1, false, alertMessage)
-			token.Wait()
-		}
+		alert.Severity = thresholds.Pressure.Severity
+		alert.Message = fmt.Sprintf("Alert: Pressure (%f) exceeded threshold (%f-%f)", value, bounds.Min, bounds.Max)
+		m.updateAlert(alert, value < bounds.Min || value > bounds.Max)
 	case "wind":
-		if value > thresholds.Wind.Speed {
-			alertMessage := fmt.Sprintf("Alert: Wind (%f) exceeded threshold (%f)", value, thresholds.Wind.Speed)
-			token := client.Publish(getAlertTopicFromMessageTopic(message.Topic()), 1, false, alertMessage)
-			token.Wait()
-		}
+		alert.Severity = thresholds.Wind.Severity
+		alert.Message = fmt.Sprintf("Alert: Wind (%f) exceeded threshold (%f)", value, thresholds.Wind.Speed)
+		m.updateAlert(alert, value > thresholds.Wind.Speed)
+	case "humidity", "wind_direction":
+		// These measurements have no static threshold, they are used by composite and runway rules
 	default:
-		log.Fatalf("Unknown sensor: %s\n", sensor)
+		log.Printf("Unknown sensor %s on %s, no threshold checked\n", sensor, topic)
 	}
 
 }
 
+func defaultInstanceName() string {
+	hostname, err := os.Hostname()
+	if err != nil {
+		hostname = "alertmanager"
+	}
+	return hostname + "-" + strconv.Itoa(os.Getpid())
+}
+
 func main() {
-	client, err := mqttconnect.NewClient(BROKER, "alert_manager", onMessageReceived)
+	backtest := flag.Bool("backtest", false, "Replay historical readings through the rules and report the would-be alerts")
+	source := flag.String("source", "files", "Backtest source: files or influxdb")
+	recorderConfig := brokerconfiguration.GetFileRecorderConfig()
+	dir := flag.String("dir", recorderConfig.RecordingPath, "Directory of the filerecorder recordings")
+	pathTemplate := flag.String("pathTemplate", recorderConfig.PathTemplate, "Path template of the recordings in the directory")
+	hive := flag.Bool("hive", recorderConfig.HivePartitions, "The recordings use Hive partition directories")
+	thresholdFile := flag.String("thresholds", "config/threshold_config.yml", "Threshold file used by the backtest")
+	from := flag.String("from", "", "Start of the backtest (yyyy-mm-dd or RFC3339)")
+	to := flag.String("to", "", "End of the backtest, excluded (yyyy-mm-dd or RFC3339)")
+	airportList := flag.String("airports", "", "Comma separated airports of the backtest, all by default")
+	format := flag.String("format", "text", "Backtest report format: text or json")
+	instance := flag.String("instance", defaultInstanceName(), "Name of the instance in the leader election")
+	flag.Parse()
+
+	airportInfo, err := airports.LoadConfig("config/airport_config.yml")
+	if err != nil {
+		log.Fatal("Error loading airport configuration:", err)
+		return
+	}
+
+	if *backtest {
+		options := BacktestOptions{Source: *source, Dir: *dir, Thresholds: *thresholdFile, Format: *format}
+		options.Layout, err = recordings.NewLayout(*pathTemplate, *hive, "")
+		if err != nil {
+			log.Fatal("Invalid recording path template:", err)
+			return
+		}
+		options.From, err = parseBacktestTime(*from)
+		if err != nil {
+			log.Fatal("Invalid start date:", err)
+			return
+		}
+		options.To, err = parseBacktestTime(*to)
+		if err != nil {
+			log.Fatal("Invalid end date:", err)
+			return
+		}
+		if *airportList != "" {
+			options.Airports = strings.Split(*airportList, ",")
+		}
+
+		err = runBacktest(options, airportInfo, os.Stdout)
+		if err != nil {
+			log.Fatal("Backtest failed:", err)
+		}
+		return
+	}
+
+	notificationConfig, err := notifications.LoadConfig("config/notification_config.yml")
+	if err != nil {
+		log.Fatal("Error loading notification configuration:", err)
+		return
+	}
+
+	dispatcher, err := notifications.NewDispatcher(notificationConfig)
+	if err != nil {
+		log.Fatal("Error creating notification sinks:", err)
+		return
+	}
+	state := newAlertState(historySize)
+	state.configureRepeatInterval(notificationConfig.RepeatInterval)
+
+	silences, err := loadSilences("config/silence_config.yml")
+	if err != nil {
+		log.Fatal("Error loading silences:", err)
+		return
+	}
+	for _, silence := range silences {
+		state.addSilence(silence)
+	}
+
+	thresholds, err := loadThresholds("config/threshold_config.yml")
+	if err != nil {
+		log.Fatal("Error loading thresholds:", err)
+		return
+	}
+	state.configureIncidents(thresholds.Incidents)
+
+	clientID := "alert_manager"
+	leaderSettings := brokerconfiguration.GetLeaderElectionSettings()
+	if leaderSettings[0] > 0 {
+		clientID += "_" + *instance
+	}
+
+	mqttClient, err := mqttconnect.NewClient(BROKER, clientID, nil)
 	if err != nil {
 		log.Fatal("Error creating MQTT client:", err)
 		return
 	}
 
-	err = client.Subscribe(TOPIC, 1, nil)
+	var election *leaderElection
+	if leaderSettings[0] > 0 {
+		election = newLeaderElection(*instance, leaderSettings[0], leaderSettings[1], mqttClient)
+	}
+	manager := newAlertManager(state, leaderPublisher{publisher: mqttClient, election: election}, dispatcher, airportInfo, election)
+	manager.thresholds.Store(thresholds)
+	messages := newProcessor(settings[0], settings[1], manager.processMessage)
+
+	go manager.reloadThresholds("config/threshold_config.yml", 30*time.Second)
+	go manager.runStatePublisher()
+	manager.startWatchdog(thresholds.Watchdog)
+	go manager.runEscalations()
+	go manager.runIncidentUpdates()
+
+	if leaderSettings[0] > 0 {
+		// Followers follow the state of the leader to take over without re-sending alerts
+		err = mqttClient.Subscribe(STATE_TOPIC, 1, manager.onStateReceived)
+		if err != nil {
+			log.Println("Error subscribing to topic:", err)
+			return
+		}
+
+		err = mqttClient.Subscribe(LEADER_TOPIC, 1, election.onLeaseReceived)
+		if err != nil {
+			log.Println("Error subscribing to topic:", err)
+			return
+		}
+		go election.run(manager.publishState)
+	}
+
+	err = mqttClient.Subscribe(TOPIC, 1, messages.onMessageReceived)
+	if err != nil {
+		log.Println("Error subscribing to topic:", err)
+		return
+	}
+
+	err = mqttClient.Subscribe(COMMAND_TOPIC+"silences", 1, manager.onSilenceCommand)
+	if err != nil {
+		log.Println("Error subscribing to topic:", err)
+		return
+	}
+
+	err = mqttClient.Subscribe(COMMAND_TOPIC+"ack", 1, manager.onAckCommand)
 	if err != nil {
 		log.Println("Error subscribing to topic:", err)
 		return
 	}
 
 	mqttconnect.WaitForSignal()
+	// Stop the readings before closing the queues they are submitted to
+	err = mqttClient.Unsubscribe(TOPIC)
+	if err != nil {
+		log.Println("Error unsubscribing from readings:", err)
+	}
+	messages.close()
+	if leaderSettings[0] > 0 {
+		election.release()
+	}
+	mqttClient.Disconnect()
 }
@@ -0,0 +1,919 @@
+package main
+
+import (
+	"ArchiD-Projet/internal/airports"
+	"ArchiD-Projet/internal/alerts"
+	"ArchiD-Projet/internal/notifications"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"github.com/Knetic/govaluate"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+type countingPublisher struct {
+	published atomic.Int64
+}
+
+func (p *countingPublisher) PublishAsync(_ string, _ byte, _ bool, _ interface{}, _ func(error)) {
+	p.published.Add(1)
+}
+
+func loadTestAirports(tb testing.TB) *airports.Config {
+	airportInfo, err := airports.LoadConfig("../../config/airport_config.yml")
+	if err != nil {
+		tb.Fatal(err)
+	}
+	return airportInfo
+}
+
+func setupAlertManager(tb testing.TB) *alertManager {
+	thresholds, err := loadThresholds("../../config/threshold_config.yml")
+	if err != nil {
+		tb.Fatal(err)
+	}
+
+	dispatcher, err := notifications.NewDispatcher(notifications.Config{})
+	if err != nil {
+		tb.Fatal(err)
+	}
+	manager := newAlertManager(newAlertState(historySize), &countingPublisher{}, dispatcher, loadTestAirports(tb), nil)
+	manager.thresholds.Store(thresholds)
+	return manager
+}
+
+func TestProcessorKeepsAirportOrder(t *testing.T) {
+	var mutex sync.Mutex
+	received := make(map[string][]string)
+
+	p := newProcessor(4, 2, func(topic string, payload []byte) {
+		mutex.Lock()
+		received[topic] = append(received[topic], string(payload))
+		mutex.Unlock()
+	})
+
+	for i := 0; i < 100; i++ {
+		for _, airport := range []string{"MRS", "LYS", "CDG", "NCE"} {
+			p.submit(airport, incomingMessage{topic: airport, payload: []byte(fmt.Sprint(i))})
+		}
+	}
+	p.close()
+
+	for airport, payloads := range received {
+		for i, payload := range payloads {
+			if payload != fmt.Sprint(i) {
+				t.Fatalf("messages of %s processed out of order: got %s at position %d", airport, payload, i)
+			}
+		}
+	}
+}
+
+func TestProcessorDropsMessagesAfterClose(t *testing.T) {
+	var handled atomic.Int64
+	p := newProcessor(2, 1, func(_ string, _ []byte) { handled.Add(1) })
+	p.submit("LYS", incomingMessage{topic: "LYS"})
+	p.close()
+
+	// A message still delivered by the broker during the shutdown must not panic
+	p.submit("LYS", incomingMessage{topic: "LYS"})
+	if handled.Load() != 1 {
+		t.Errorf("handled %d messages, want 1", handled.Load())
+	}
+}
+
+// BenchmarkProcessMessages feeds readings of 300 airports through the worker pool.
+func TestProcessMessageDropsBadPayloads(t *testing.T) {
+	manager := setupAlertManager(t)
+
+	// A bad payload is logged and dropped without stopping the workers
+	for _, payload := range []string{"", "2024-01-19 10:00:00", "2024-01-19 10:00:00 wind", "2024-01-19 10:00:00 visibility 1200.000000"} {
+		manager.processMessage("airports/LYS", []byte(payload))
+	}
+	if active := manager.state.snapshot(time.Now()).Active; len(active) != 0 {
+		t.Errorf("alerts raised by bad payloads: %+v", active)
+	}
+}
+
+func BenchmarkProcessMessages(b *testing.B) {
+	manager := setupAlertManager(b)
+
+	measurements := []struct {
+		name  string
+		value float64
+	}{{"temperature", 285.0}, {"pressure", 1015.0}, {"wind", 8.0}, {"wind_direction", 180.0}}
+	start := time.Date(2024, 1, 19, 0, 0, 0, 0, time.UTC)
+
+	for _, workers := range []int{1, 8, 32} {
+		b.Run(fmt.Sprintf("workers=%d", workers), func(b *testing.B) {
+			batch := make([]incomingMessage, b.N)
+			airportsOfBatch := make([]string, b.N)
+			for i := range batch {
+				airport := fmt.Sprintf("A%03d", i%300)
+				measurement := measurements[(i/300)%len(measurements)]
+				timestamp := start.Add(time.Duration(i/1200) * 6 * time.Minute)
+				payload := fmt.Sprintf("%s %s %f", timestamp.Format("2006-01-02 15:04:05"), measurement.name, measurement.value+float64(i%7))
+				batch[i] = incomingMessage{topic: "airports/" + airport, payload: []byte(payload)}
+				airportsOfBatch[i] = airport
+			}
+
+			p := newProcessor(workers, 1000, manager.processMessage)
+			b.ResetTimer()
+			for i, message := range batch {
+				p.submit(airportsOfBatch[i], message)
+			}
+			p.close()
+		})
+	}
+}
+
+func TestBacktestFromRecordings(t *testing.T) {
+	dir := t.TempDir()
+	lines := []string{
+		"2024-01-19 10:00:00 wind 30.0",
+		"2024-01-19 10:10:00 wind 65.0",
+		"2024-01-19 10:40:00 wind 20.0",
+		"2024-01-19 11:00:00 wind 70.0",
+		"2024-01-19 11:05:00 wind 75.0",
+	}
+	err := os.WriteFile(filepath.Join(dir, "MRS_2024-01-19.csv"), []byte(strings.Join(lines, "\n")+"\n"), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	from, _ := parseBacktestTime("2024-01-19")
+	to, _ := parseBacktestTime("2024-01-20")
+	var output bytes.Buffer
+	err = runBacktest(BacktestOptions{Source: "files", Dir: dir, Thresholds: "../../config/threshold_config.yml", From: from, To: to, Format: "json"}, loadTestAirports(t), &output)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var results []BacktestResult
+	err = json.Unmarshal(output.Bytes(), &results)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, result := range results {
+		if result.Rule != "wind" {
+			continue
+		}
+		if result.Count != 2 || result.Ongoing != 1 || result.TotalDuration != 35*time.Minute || result.LongestAlert != 30*time.Minute {
+			t.Fatalf("unexpected wind result: %+v", result)
+		}
+		return
+	}
+	t.Fatalf("no wind alert in the backtest: %+v", results)
+}
+
+func TestEscalationAfterDelay(t *testing.T) {
+	received := make(chan string, 10)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		received <- r.URL.Path
+	}))
+	defer server.Close()
+
+	dispatcher, err := notifications.NewDispatcher(notifications.Config{
+		Sinks: []notifications.SinkConfig{{Name: "managers", Type: "webhook", URL: server.URL + "/managers", EscalationOnly: true}},
+		Escalations: []notifications.EscalationPolicy{{
+			Name:  "critical-wind",
+			Match: notifications.Match{Severities: []string{alerts.SeverityCritical}, Rules: []string{"wind"}},
+			Steps: []notifications.EscalationStep{{After: 15 * time.Minute, Targets: []string{"managers"}}},
+		}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	manager := newAlertManager(newAlertState(0), &countingPublisher{}, dispatcher, nil, nil)
+
+	start := time.Date(2024, 1, 19, 10, 0, 0, 0, time.UTC)
+	// The observation is late, the delay runs from the notification
+	alert := alerts.Alert{ID: "1", Airport: "MRS", Measurement: "wind", Rule: "wind", Severity: alerts.SeverityCritical, Status: alerts.StatusFiring, StartsAt: start.Add(-time.Hour), NotifiedAt: start}
+
+	manager.checkEscalations([]alerts.Alert{alert}, start.Add(5*time.Minute))
+	manager.checkEscalations([]alerts.Alert{alert}, start.Add(10*time.Minute))
+	select {
+	case path := <-received:
+		t.Fatalf("escalation sent to %s before its delay", path)
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	manager.checkEscalations([]alerts.Alert{alert}, start.Add(15*time.Minute))
+	select {
+	case path := <-received:
+		if path != "/managers" {
+			t.Errorf("escalation sent to %s", path)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("escalation not sent after 15 minutes")
+	}
+
+	alert.Acknowledgement = &alerts.Acknowledgement{AlertID: "1", By: "ops"}
+	manager.checkEscalations([]alerts.Alert{alert}, start.Add(16*time.Minute))
+	if len(manager.escalations) != 0 {
+		t.Errorf("acknowledged alert still escalating")
+	}
+
+	// An instance seeing the alert for the first time after its delay escalates it at once
+	late := alerts.Alert{ID: "2", Airport: "LYS", Measurement: "wind", Rule: "wind", Severity: alerts.SeverityCritical, Status: alerts.StatusFiring, StartsAt: start, NotifiedAt: start}
+	manager.checkEscalations([]alerts.Alert{late}, start.Add(20*time.Minute))
+	select {
+	case <-received:
+	case <-time.After(time.Second):
+		t.Fatal("escalation of an alert started before the restart not sent")
+	}
+}
+
+func TestEscalationSendsLatestDueStep(t *testing.T) {
+	received := make(chan string, 10)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		received <- r.URL.Path
+	}))
+	defer server.Close()
+
+	dispatcher, err := notifications.NewDispatcher(notifications.Config{
+		Sinks: []notifications.SinkConfig{
+			{Name: "managers", Type: "webhook", URL: server.URL + "/managers", EscalationOnly: true},
+			{Name: "directors", Type: "webhook", URL: server.URL + "/directors", EscalationOnly: true},
+		},
+		Escalations: []notifications.EscalationPolicy{{
+			Name:  "critical-wind",
+			Match: notifications.Match{Severities: []string{alerts.SeverityCritical}},
+			Steps: []notifications.EscalationStep{
+				{After: 15 * time.Minute, Targets: []string{"managers"}},
+				{After: 30 * time.Minute, Targets: []string{"directors"}},
+			},
+			Repeat: notifications.RepeatRule{Interval: 10 * time.Minute, Times: 3},
+		}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	manager := newAlertManager(newAlertState(0), &countingPublisher{}, dispatcher, nil, nil)
+
+	// Both steps and two repeats are due when the alert is first seen
+	start := time.Date(2024, 1, 19, 10, 0, 0, 0, time.UTC)
+	alert := alerts.Alert{ID: "1", Airport: "MRS", Measurement: "wind", Rule: "wind", Severity: alerts.SeverityCritical, Status: alerts.StatusFiring, StartsAt: start, NotifiedAt: start}
+	manager.checkEscalations([]alerts.Alert{alert}, start.Add(55*time.Minute))
+	select {
+	case path := <-received:
+		if path != "/directors" {
+			t.Errorf("latest due step sent to %s", path)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("no escalation sent")
+	}
+	select {
+	case path := <-received:
+		t.Errorf("escalation steps sent in a burst, also to %s", path)
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	manager.checkEscalations([]alerts.Alert{alert}, start.Add(60*time.Minute))
+	select {
+	case <-received:
+	case <-time.After(time.Second):
+		t.Fatal("last repeat not sent")
+	}
+	if progress := manager.escalations["1"]; progress.sent != 5 {
+		t.Errorf("escalation progress at %d steps, want 5", progress.sent)
+	}
+}
+
+func newTestWindows() *airportWindows {
+	return &airportWindows{series: make(map[string]*seriesWindow), expressions: make(map[string]*govaluate.EvaluableExpression)}
+}
+
+func TestCheckComposite(t *testing.T) {
+	start := time.Date(2024, 1, 19, 10, 0, 0, 0, time.UTC)
+	rules := []CompositeRule{
+		{Name: "pressure_drop", Expression: "change('pressure', '3h') < -2", Severity: alerts.SeverityWarning},
+		{Name: "wind_with_falling_pressure", Expression: "wind > 15 && change('pressure', '3h') < -2"},
+		{Name: "icing_risk", Expression: "temperature < 276.15 && humidity > 90", MaxAge: 10 * time.Minute},
+	}
+	record := func(windows *airportWindows, measurement string, at time.Duration, value float64) []ruleResult {
+		reading := alerts.Alert{Airport: "LYS", Measurement: measurement, Value: value, Time: start.Add(at)}
+		windows.recordSample(reading, nil)
+		return windows.checkComposite(reading, rules)
+	}
+	firing := func(results []ruleResult) map[string]bool {
+		byRule := make(map[string]bool)
+		for _, result := range results {
+			byRule[result.alert.Rule] = result.firing
+		}
+		return byRule
+	}
+
+	windows := newTestWindows()
+	if results := record(windows, "pressure", 0, 1015); !reflect.DeepEqual(firing(results), map[string]bool{"pressure_drop": false}) {
+		t.Errorf("unexpected results of the first pressure reading: %v", firing(results))
+	}
+	if results := record(windows, "pressure", 2*time.Hour, 1012); !reflect.DeepEqual(firing(results), map[string]bool{"pressure_drop": true}) {
+		t.Errorf("rule using only change() not firing on a pressure drop: %v", firing(results))
+	}
+	if results := record(windows, "wind", 2*time.Hour, 20); !reflect.DeepEqual(firing(results), map[string]bool{"wind_with_falling_pressure": true}) {
+		t.Errorf("unexpected results of the wind reading: %v", firing(results))
+	}
+	if results := record(windows, "wind", 3*time.Hour, 20); len(results) != 0 {
+		t.Errorf("rule evaluated with a stale pressure: %v", firing(results))
+	}
+
+	windows = newTestWindows()
+	record(windows, "humidity", 0, 95)
+	if results := record(windows, "temperature", 5*time.Minute, 275); !reflect.DeepEqual(firing(results), map[string]bool{"icing_risk": true}) {
+		t.Errorf("unexpected results of the temperature reading: %v", firing(results))
+	}
+	if results := record(windows, "temperature", 15*time.Minute, 275); len(results) != 0 {
+		t.Errorf("rule evaluated with a humidity older than its maxAge: %v", firing(results))
+	}
+}
+
+func TestWindChill(t *testing.T) {
+	tests := []struct {
+		temperature, wind, want float64
+	}{
+		// Above 10°C or below 4.8 km/h the wind chill is the temperature
+		{288.15, 20, 288.15},
+		{263.15, 1, 263.15},
+		{263.15, 30 / 3.6, 253.63},
+		{253.15, 50 / 3.6, 237.75},
+	}
+
+	for _, test := range tests {
+		if got := windChill(test.temperature, test.wind); math.Abs(got-test.want) > 0.01 {
+			t.Errorf("windChill(%v, %v) = %v, want %v", test.temperature, test.wind, got, test.want)
+		}
+	}
+}
+
+func TestChangeFunction(t *testing.T) {
+	start := time.Date(2024, 1, 19, 10, 0, 0, 0, time.UTC)
+	windows := newTestWindows()
+	for i, value := range []float64{1015, 1014, 1012, 1011} {
+		windows.recordSample(alerts.Alert{Measurement: "pressure", Value: value, Time: start.Add(time.Duration(i) * time.Hour)}, nil)
+	}
+	windows.now = start.Add(3 * time.Hour)
+
+	change := windows.compositeFunctions()["change"]
+	tests := []struct {
+		period string
+		want   float64
+	}{
+		{"3h", -4},
+		{"1h", -1},
+		{"30m", 0},
+		// Only the retained samples are known
+		{"12h", -4},
+	}
+	for _, test := range tests {
+		got, err := change("pressure", test.period)
+		if err != nil || got != test.want {
+			t.Errorf("change(pressure, %s) = %v, %v, want %v", test.period, got, err, test.want)
+		}
+	}
+
+	if _, err := change("humidity", "1h"); err == nil {
+		t.Error("change of a measurement without data did not fail")
+	}
+	if _, err := change("pressure", "soon"); err == nil {
+		t.Error("change with an invalid duration did not fail")
+	}
+}
+
+func TestFireNotifiesChanges(t *testing.T) {
+	s := newAlertState(0)
+	s.configureRepeatInterval(time.Hour)
+
+	start := time.Date(2024, 1, 19, 10, 0, 0, 0, time.UTC)
+	wind := alerts.Alert{Airport: "LYS", Measurement: "wind", Rule: "wind", Severity: alerts.SeverityWarning, Time: start}
+	tests := []struct {
+		name     string
+		severity string
+		at       time.Duration
+		notify   bool
+	}{
+		{"new alert", alerts.SeverityWarning, 0, true},
+		{"still firing", alerts.SeverityWarning, 10 * time.Minute, false},
+		{"escalated", alerts.SeverityCritical, 20 * time.Minute, true},
+		{"same severity", alerts.SeverityCritical, 30 * time.Minute, false},
+		{"lower severity", alerts.SeverityWarning, 40 * time.Minute, false},
+		{"repeat interval", alerts.SeverityWarning, 80 * time.Minute, true},
+		{"after the repeat", alerts.SeverityWarning, 90 * time.Minute, false},
+	}
+	for _, test := range tests {
+		wind.Severity = test.severity
+		wind.Time = start.Add(test.at)
+		_, notify := s.fire(wind, wind.Time)
+		if notify != test.notify {
+			t.Errorf("%s: notify = %v, want %v", test.name, notify, test.notify)
+		}
+	}
+
+	s.resolve(wind)
+	if _, notify := s.fire(wind, start.Add(100*time.Minute)); !notify {
+		t.Errorf("alert firing again after its resolution not notified")
+	}
+}
+
+func TestIncidentGrouping(t *testing.T) {
+	s := newAlertState(0)
+	s.configureIncidents(IncidentConfig{Window: 30 * time.Minute, UpdateInterval: 5 * time.Minute})
+
+	start := time.Date(2024, 1, 19, 10, 0, 0, 0, time.UTC)
+	wind, _ := s.fire(alerts.Alert{Airport: "LYS", Measurement: "wind", Rule: "wind", Severity: alerts.SeverityCritical, Time: start}, start)
+	pressure, _ := s.fire(alerts.Alert{Airport: "LYS", Measurement: "pressure", Rule: "pressure", Severity: alerts.SeverityWarning, Time: start.Add(10 * time.Minute)}, start)
+	other, _ := s.fire(alerts.Alert{Airport: "MRS", Measurement: "wind", Rule: "wind", Severity: alerts.SeverityCritical, Time: start}, start)
+
+	if wind.IncidentID == "" || wind.IncidentID != pressure.IncidentID || other.IncidentID == wind.IncidentID {
+		t.Fatalf("unexpected grouping: %s %s %s", wind.IncidentID, pressure.IncidentID, other.IncidentID)
+	}
+
+	notifications := s.incidentNotifications(start)
+	if len(notifications) != 2 {
+		t.Fatalf("expected one opening notification per incident, got %d", len(notifications))
+	}
+	// The sinks are matched against the rules of the member alerts
+	for _, update := range notifications {
+		if update.notification.IncidentID != wind.IncidentID {
+			continue
+		}
+		if len(update.members) != 2 || update.members[0].Rule != "wind" || update.members[1].Rule != "pressure" || update.members[1].Measurement != "pressure" {
+			t.Errorf("unexpected incident members: %+v", update.members)
+		}
+	}
+
+	s.resolve(alerts.Alert{Airport: "LYS", Measurement: "wind", Rule: "wind", Time: start.Add(20 * time.Minute)})
+	if len(s.incidentNotifications(start.Add(time.Minute))) != 0 {
+		t.Errorf("incident update sent before the update interval")
+	}
+	if len(s.incidentNotifications(start.Add(5*time.Minute))) != 1 {
+		t.Errorf("incident update not sent after the update interval")
+	}
+
+	s.resolve(alerts.Alert{Airport: "LYS", Measurement: "pressure", Rule: "pressure", Time: start.Add(30 * time.Minute)})
+	late, _ := s.fire(alerts.Alert{Airport: "LYS", Measurement: "temperature", Rule: "temperature", Time: start.Add(2 * time.Hour)}, start)
+	if late.IncidentID == wind.IncidentID {
+		t.Errorf("alert raised after the window joined the resolved incident")
+	}
+
+	incident := s.snapshot(start).Incidents[0]
+	if incident.Status != alerts.IncidentResolved || len(incident.Timeline) != 4 || incident.Severity != alerts.SeverityCritical {
+		t.Errorf("unexpected incident: %+v", incident)
+	}
+}
+
+func TestLeaderElection(t *testing.T) {
+	start := time.Date(2024, 1, 19, 10, 0, 0, 0, time.UTC)
+	a := newLeaderElection("a", 15*time.Second, 5*time.Second, nil)
+	b := newLeaderElection("b", 15*time.Second, 5*time.Second, nil)
+
+	// Both instances start without a lease and claim it, the lowest name keeps it
+	leaseA, publishA, _ := a.tick(start)
+	leaseB, publishB, _ := b.tick(start)
+	if !publishA || !publishB {
+		t.Fatal("expected both instances to claim the free lease")
+	}
+	a.receive(leaseB, start)
+	b.receive(leaseA, start)
+	if !a.isLeader() || b.isLeader() {
+		t.Fatalf("expected a to be the only leader, got a=%v b=%v", a.isLeader(), b.isLeader())
+	}
+
+	// The follower waits while the leader renews its lease
+	var last time.Time
+	for now := start; now.Before(start.Add(time.Minute)); now = now.Add(5 * time.Second) {
+		last = now
+		renewed, _, _ := a.tick(now)
+		b.receive(renewed, now)
+		if _, publish, _ := b.tick(now); publish {
+			t.Fatalf("follower claimed a renewed lease at %s", now)
+		}
+	}
+
+	// The follower takes over once the lease is no longer renewed
+	if _, _, promoted := b.tick(last.Add(10 * time.Second)); promoted {
+		t.Fatal("follower took over before the lease expired")
+	}
+	if _, _, promoted := b.tick(last.Add(15 * time.Second)); !promoted {
+		t.Fatal("follower did not take over the expired lease")
+	}
+}
+
+func TestStateHandover(t *testing.T) {
+	start := time.Date(2024, 1, 19, 10, 0, 0, 0, time.UTC)
+	leader := newAlertState(historySize)
+	leader.configureIncidents(IncidentConfig{Window: 30 * time.Minute})
+	firing, _ := leader.fire(alerts.Alert{Airport: "LYS", Measurement: "wind", Rule: "wind", Severity: alerts.SeverityCritical, Time: start}, start)
+	leader.acknowledge(alerts.Acknowledgement{AlertID: firing.ID, By: "ops"})
+
+	follower := newAlertState(historySize)
+	follower.configureIncidents(IncidentConfig{Window: 30 * time.Minute})
+	follower.restore(leader.snapshot(start), start)
+
+	again, notify := follower.fire(alerts.Alert{Airport: "LYS", Measurement: "wind", Rule: "wind", Severity: alerts.SeverityCritical, Time: start.Add(time.Minute)}, start)
+	if again.ID != firing.ID || notify {
+		t.Errorf("acknowledged alert re-sent after the handover: %+v", again)
+	}
+	if len(follower.incidentNotifications(start.Add(time.Hour))) != 0 {
+		t.Errorf("incident notified again after the handover")
+	}
+
+	resolved, ok := follower.resolve(alerts.Alert{Airport: "LYS", Measurement: "wind", Rule: "wind", Time: start.Add(2 * time.Minute)})
+	if !ok || resolved.ID != firing.ID {
+		t.Errorf("firing alert lost in the handover")
+	}
+	if history := follower.snapshot(start).History; history[len(history)-1].Status != alerts.StatusResolved {
+		t.Errorf("resolution not recorded in the history after the handover")
+	}
+}
+
+func TestStateHandoverKeepsAlertsOutOfHistory(t *testing.T) {
+	start := time.Date(2024, 1, 19, 10, 0, 0, 0, time.UTC)
+	leader := newAlertState(2)
+	wind, _ := leader.fire(alerts.Alert{Airport: "LYS", Measurement: "wind", Rule: "wind", Time: start}, start)
+	for i := 1; i <= 3; i++ {
+		temperature := alerts.Alert{Airport: "LYS", Measurement: "temperature", Rule: "temperature", Time: start.Add(time.Duration(i) * time.Minute)}
+		leader.fire(temperature, start)
+		leader.resolve(temperature)
+	}
+
+	snapshot := leader.snapshot(start)
+	for _, alert := range snapshot.History {
+		if alert.ID == wind.ID {
+			t.Fatal("expected the wind alert to leave the history")
+		}
+	}
+
+	follower := newAlertState(2)
+	follower.restore(snapshot, start)
+	again, notify := follower.fire(alerts.Alert{Airport: "LYS", Measurement: "wind", Rule: "wind", Time: start.Add(time.Hour)}, start.Add(time.Hour))
+	if again.ID != wind.ID || notify {
+		t.Errorf("alert out of the history lost in the handover: %+v", again)
+	}
+}
+
+func TestSeriesWindowExtremes(t *testing.T) {
+	start := time.Date(2024, 1, 19, 10, 0, 0, 0, time.UTC)
+	window := &seriesWindow{}
+	for i, value := range []float64{1010, 1016, 1012, 1008, 1011} {
+		window.add(sample{time: start.Add(time.Duration(i) * time.Hour), value: value}, minimumRetention)
+	}
+
+	tests := []struct {
+		name      string
+		since     time.Time
+		low, high float64
+	}{
+		{"whole window", start, 1008, 1016},
+		{"before the window", start.Add(-time.Hour), 1008, 1016},
+		{"from the highest sample", start.Add(time.Hour), 1008, 1016},
+		{"just after the highest sample", start.Add(time.Hour + time.Second), 1008, 1012},
+		{"latest sample only", start.Add(4 * time.Hour), 1011, 1011},
+		{"after the latest sample", start.Add(5 * time.Hour), 1011, 1011},
+	}
+	for _, test := range tests {
+		low, high := window.extremes(test.since)
+		if low != test.low || high != test.high {
+			t.Errorf("%s: extremes = %v, %v, want %v, %v", test.name, low, high, test.low, test.high)
+		}
+	}
+
+	single := &seriesWindow{}
+	single.add(sample{time: start, value: 5}, minimumRetention)
+	if low, high := single.extremes(start.Add(-time.Hour)); low != 5 || high != 5 {
+		t.Errorf("extremes of a single sample = %v, %v", low, high)
+	}
+}
+
+func TestCheckRateOfChange(t *testing.T) {
+	start := time.Date(2024, 1, 19, 10, 0, 0, 0, time.UTC)
+	rules := []RateOfChangeRule{
+		{Name: "pressure_drop", Measurement: "pressure", Direction: "fall", Change: 3, Window: 3 * time.Hour},
+		{Name: "pressure_rise", Measurement: "pressure", Direction: "rise", Change: 3, Window: 3 * time.Hour},
+	}
+
+	tests := []struct {
+		name   string
+		values []float64
+		// Firing state of the drop and rise rules on the last value
+		drop, rise bool
+	}{
+		{"single sample", []float64{1015}, false, false},
+		{"steady", []float64{1015, 1015, 1015, 1015}, false, false},
+		{"fall", []float64{1015, 1014, 1012, 1011}, true, false},
+		{"rise", []float64{1011, 1012, 1014, 1015}, false, true},
+		{"change equal to the threshold", []float64{1015, 1014, 1013, 1012}, false, false},
+		{"fall from a peak inside the window", []float64{1010, 1016, 1014, 1012}, true, false},
+		{"fall from a peak out of the window", []float64{1020, 1016, 1015, 1014, 1013}, false, false},
+		{"rise after a fall", []float64{1015, 1010, 1012, 1014}, false, true},
+	}
+	for _, test := range tests {
+		window := &seriesWindow{}
+		var results []ruleResult
+		for i, value := range test.values {
+			reading := alerts.Alert{Airport: "LYS", Measurement: "pressure", Value: value, Time: start.Add(time.Duration(i) * time.Hour)}
+			window.add(sample{time: reading.Time, value: reading.Value}, minimumRetention)
+			results = checkRateOfChange(window, reading, rules)
+		}
+
+		if len(results) != 2 {
+			t.Fatalf("%s: expected the results of both rules, got %d", test.name, len(results))
+		}
+		if results[0].firing != test.drop || results[1].firing != test.rise {
+			t.Errorf("%s: drop firing %v, rise firing %v, want %v, %v", test.name, results[0].firing, results[1].firing, test.drop, test.rise)
+		}
+	}
+
+	other := alerts.Alert{Airport: "LYS", Measurement: "wind", Value: 10, Time: start}
+	if results := checkRateOfChange(&seriesWindow{samples: []sample{{start, 10}}}, other, rules); len(results) != 0 {
+		t.Errorf("rules evaluated on another measurement: %v", results)
+	}
+}
+
+func TestIsSilenced(t *testing.T) {
+	start := time.Date(2024, 1, 19, 10, 0, 0, 0, time.UTC)
+	s := newAlertState(0)
+	s.addSilence(alerts.Silence{ID: "maintenance", Airport: "LYS", StartsAt: start, EndsAt: start.Add(time.Hour)})
+	s.addSilence(alerts.Silence{ID: "wind", Measurement: "wind", Rule: "wind", StartsAt: start.Add(2 * time.Hour), EndsAt: start.Add(3 * time.Hour)})
+
+	wind := alerts.Alert{Airport: "MRS", Measurement: "wind", Rule: "wind"}
+	pressure := alerts.Alert{Airport: "LYS", Measurement: "pressure", Rule: "pressure_drop"}
+	tests := []struct {
+		name  string
+		alert alerts.Alert
+		at    time.Time
+		want  bool
+	}{
+		{"before the silence", pressure, start.Add(-time.Second), false},
+		{"start of the silence", pressure, start, true},
+		{"during the silence", pressure, start.Add(30 * time.Minute), true},
+		{"end of the silence", pressure, start.Add(time.Hour), false},
+		{"other airport", alerts.Alert{Airport: "MRS", Measurement: "pressure", Rule: "pressure_drop"}, start, false},
+		{"matching measurement and rule", wind, start.Add(2 * time.Hour), true},
+		{"other rule of the measurement", alerts.Alert{Airport: "MRS", Measurement: "wind", Rule: "crosswind_13L"}, start.Add(2 * time.Hour), false},
+	}
+	for _, test := range tests {
+		if got := s.isSilenced(test.alert, test.at); got != test.want {
+			t.Errorf("%s: isSilenced = %v, want %v", test.name, got, test.want)
+		}
+	}
+
+	// A silence with the same ID replaces the previous one
+	s.addSilence(alerts.Silence{ID: "maintenance", Airport: "LYS", StartsAt: start, EndsAt: start.Add(2 * time.Hour)})
+	if !s.isSilenced(pressure, start.Add(90*time.Minute)) || len(s.silences) != 2 {
+		t.Errorf("silence not extended: %+v", s.silences)
+	}
+
+	// A silenced alert is recorded but only notified once its silence ends
+	firing, notify := s.fire(pressure, start)
+	if !firing.Silenced || notify {
+		t.Errorf("silenced alert notified: %+v", firing)
+	}
+	firing, notify = s.fire(pressure, start.Add(2*time.Hour))
+	if firing.Silenced || !notify {
+		t.Errorf("alert not notified at the end of its silence: %+v", firing)
+	}
+}
+
+func TestAlertLifecycle(t *testing.T) {
+	start := time.Date(2024, 1, 19, 10, 0, 0, 0, time.UTC)
+	s := newAlertState(0)
+	wind := alerts.Alert{Airport: "LYS", Measurement: "wind", Rule: "wind", Severity: alerts.SeverityWarning, Value: 20, Time: start}
+
+	firing, notify := s.fire(wind, start)
+	if firing.ID == "" || firing.Status != alerts.StatusFiring || !firing.StartsAt.Equal(start) || !firing.NotifiedAt.Equal(start) || !notify {
+		t.Fatalf("unexpected new alert: %+v, notify %v", firing, notify)
+	}
+
+	wind.Value = 25
+	wind.Time = start.Add(10 * time.Minute)
+	again, _ := s.fire(wind, wind.Time)
+	if again.ID != firing.ID || again.Value != 25 || !again.StartsAt.Equal(start) {
+		t.Errorf("firing alert not updated: %+v", again)
+	}
+
+	if err := s.acknowledge(alerts.Acknowledgement{AlertID: "unknown", By: "ops"}); err == nil {
+		t.Error("acknowledged an unknown alert")
+	}
+	if err := s.acknowledge(alerts.Acknowledgement{AlertID: firing.ID, By: "ops"}); err != nil {
+		t.Fatal(err)
+	}
+	acknowledged, notify := s.fire(wind, start.Add(20*time.Minute))
+	if acknowledged.Acknowledgement == nil || acknowledged.Acknowledgement.By != "ops" || notify {
+		t.Errorf("acknowledgement not kept: %+v, notify %v", acknowledged, notify)
+	}
+
+	// An escalation clears the acknowledgement and is notified
+	wind.Severity = alerts.SeverityCritical
+	escalated, notify := s.fire(wind, start.Add(30*time.Minute))
+	if escalated.Acknowledgement != nil || escalated.Severity != alerts.SeverityCritical || !escalated.NotifiedAt.Equal(start.Add(30*time.Minute)) || !notify {
+		t.Errorf("escalation not notified: %+v, notify %v", escalated, notify)
+	}
+
+	wind.Time = start.Add(40 * time.Minute)
+	resolved, ok := s.resolve(wind)
+	if !ok || resolved.ID != firing.ID || resolved.Status != alerts.StatusResolved || resolved.EndsAt == nil || !resolved.EndsAt.Equal(wind.Time) {
+		t.Errorf("unexpected resolved alert: %+v", resolved)
+	}
+	if _, ok := s.resolve(wind); ok {
+		t.Error("resolved alert resolved again")
+	}
+	if err := s.acknowledge(alerts.Acknowledgement{AlertID: firing.ID, By: "ops"}); err == nil {
+		t.Error("acknowledged a resolved alert")
+	}
+
+	next, _ := s.fire(wind, start.Add(time.Hour))
+	if next.ID == firing.ID {
+		t.Error("alert firing again kept the ID of the resolved one")
+	}
+	if history := s.snapshot(start).History; len(history) != 2 || history[0].Status != alerts.StatusResolved || history[1].Status != alerts.StatusFiring {
+		t.Errorf("unexpected history: %+v", history)
+	}
+}
+
+func TestCheckStaleSeries(t *testing.T) {
+	manager := setupAlertManager(t)
+
+	start := time.Date(2024, 1, 19, 10, 0, 0, 0, time.UTC)
+	config := WatchdogConfig{MaxAge: 30 * time.Minute, Measurements: map[string]time.Duration{"humidity": 2 * time.Hour}, Severity: alerts.SeverityWarning}
+
+	// Expected series start with a full delay, a series never received is then stale
+	manager.expectSeries("NCE", "wind", start)
+	// Fresh messages republishing an old observation
+	manager.recordActivity(alerts.Alert{Airport: "LYS", Measurement: "wind", Time: start.Add(-40 * time.Minute)}, start.Add(-time.Minute))
+	// Same age under the default and the per-measurement maximum age
+	manager.recordActivity(alerts.Alert{Airport: "LYS", Measurement: "temperature", Time: start.Add(-time.Hour)}, start.Add(-time.Hour))
+	manager.recordActivity(alerts.Alert{Airport: "LYS", Measurement: "humidity", Time: start.Add(-time.Hour)}, start.Add(-time.Hour))
+	// Fresh series, whose sensor clock is ahead
+	manager.recordActivity(alerts.Alert{Airport: "MRS", Measurement: "pressure", Time: start.Add(5 * time.Minute)}, start.Add(-5*time.Minute))
+
+	tests := []struct {
+		now  time.Time
+		want map[string]bool
+	}{
+		{start, map[string]bool{"NCE/wind": false, "LYS/wind": true, "LYS/temperature": true, "LYS/humidity": false, "MRS/pressure": false}},
+		{start.Add(30 * time.Minute), map[string]bool{"NCE/wind": false, "LYS/wind": true, "LYS/temperature": true, "LYS/humidity": false, "MRS/pressure": true}},
+		{start.Add(time.Hour), map[string]bool{"NCE/wind": true, "LYS/wind": true, "LYS/temperature": true, "LYS/humidity": false, "MRS/pressure": true}},
+		{start.Add(time.Hour + time.Second), map[string]bool{"NCE/wind": true, "LYS/wind": true, "LYS/temperature": true, "LYS/humidity": true, "MRS/pressure": true}},
+	}
+	for _, test := range tests {
+		got := make(map[string]bool)
+		for _, result := range manager.checkStaleSeries(config, test.now) {
+			if result.alert.Rule != "no_data" || !result.alert.Time.Equal(test.now) {
+				t.Errorf("unexpected watchdog alert: %+v", result.alert)
+			}
+			got[seriesKey(result.alert.Airport, result.alert.Measurement)] = result.firing
+		}
+		if !reflect.DeepEqual(got, test.want) {
+			t.Errorf("at %s: stale series %v, want %v", test.now.Format(time.TimeOnly), got, test.want)
+		}
+	}
+
+	manager.recordActivity(alerts.Alert{Airport: "NCE", Measurement: "wind", Time: start.Add(2 * time.Hour)}, start.Add(2*time.Hour))
+	for _, result := range manager.checkStaleSeries(config, start.Add(2*time.Hour)) {
+		if result.alert.Airport == "NCE" && result.firing {
+			t.Error("series still stale after a fresh reading")
+		}
+	}
+}
+
+func TestCheckAnomaly(t *testing.T) {
+	start := time.Date(2024, 1, 19, 10, 0, 0, 0, time.UTC)
+	config := AnomalyConfig{Severity: alerts.SeverityInfo, Measurements: map[string]AnomalyParams{
+		"pressure": {Method: "zscore", Window: 24 * time.Hour, Warmup: 10, Sensitivity: 3},
+		"wind":     {Method: "ewma", Alpha: 0.3, Warmup: 10, Sensitivity: 3},
+		"humidity": {Method: "zscore", Window: time.Hour, Warmup: 10, Sensitivity: 3},
+	}}
+
+	tests := []struct {
+		name        string
+		measurement string
+		// Baseline readings alternate between 1010 and 1012, one every 10 minutes
+		baseline int
+		value    float64
+		// Whether the reading is scored and fires
+		scored, firing bool
+	}{
+		{"z-score during the warm-up", "pressure", 9, 1030, false, false},
+		{"z-score after the warm-up", "pressure", 10, 1030, true, true},
+		{"z-score of a usual value", "pressure", 10, 1012, true, false},
+		{"z-score of a low value", "pressure", 10, 990, true, true},
+		{"ewma during the warm-up", "wind", 9, 1030, false, false},
+		{"ewma after the warm-up", "wind", 10, 1030, true, true},
+		{"ewma of a usual value", "wind", 10, 1011, true, false},
+		// The window only ever holds 7 readings
+		{"z-score window shorter than the warm-up", "humidity", 30, 1030, false, false},
+		{"measurement without detection", "temperature", 30, 1030, false, false},
+	}
+	for _, test := range tests {
+		manager := setupAlertManager(t)
+		reading := alerts.Alert{Airport: "LYS", Measurement: test.measurement}
+		for i := 0; i < test.baseline; i++ {
+			reading.Time = start.Add(time.Duration(i) * 10 * time.Minute)
+			reading.Value = 1010 + float64(i%2)*2
+			if results := manager.checkAnomaly(reading, config); len(results) > 0 && results[0].firing {
+				t.Fatalf("%s: baseline reading %d flagged as an anomaly", test.name, i)
+			}
+		}
+
+		reading.Time = start.Add(time.Duration(test.baseline) * 10 * time.Minute)
+		reading.Value = test.value
+		results := manager.checkAnomaly(reading, config)
+		if (len(results) == 1) != test.scored {
+			t.Errorf("%s: got %d results, scored %v", test.name, len(results), test.scored)
+			continue
+		}
+		if test.scored && (results[0].firing != test.firing || results[0].alert.Rule != "anomaly") {
+			t.Errorf("%s: unexpected result %+v, want firing %v", test.name, results[0], test.firing)
+		}
+
+		// A repeat of the same observation is ignored
+		if results := manager.checkAnomaly(reading, config); len(results) != 0 {
+			t.Errorf("%s: repeated reading scored again", test.name)
+		}
+	}
+}
+
+func TestWindComponents(t *testing.T) {
+	tests := []struct {
+		heading, direction, speed float64
+		headwind, crosswind       float64
+	}{
+		{134, 134, 10, 10, 0},
+		{134, 314, 10, -10, 0},
+		{134, 224, 10, 0, 10},
+		{354, 24, 10, 8.660, 5},
+	}
+
+	for _, test := range tests {
+		headwind, crosswind := windComponents(test.heading, test.direction, test.speed)
+		if math.Abs(headwind-test.headwind) > 0.01 || math.Abs(crosswind-test.crosswind) > 0.01 {
+			t.Errorf("windComponents(%v, %v, %v) = %v, %v, want %v, %v", test.heading, test.direction, test.speed, headwind, crosswind, test.headwind, test.crosswind)
+		}
+	}
+}
+
+func TestCheckRunways(t *testing.T) {
+	start := time.Date(2024, 1, 19, 10, 0, 0, 0, time.UTC)
+	airportSeries := &airportWindows{series: make(map[string]*seriesWindow)}
+	record := func(measurement string, at time.Duration, value float64, airport airports.AirportInfo) ([]RunwayWind, []ruleResult) {
+		reading := alerts.Alert{Airport: "LYS", Measurement: measurement, Value: value, Time: start.Add(at)}
+		airportSeries.recordSample(reading, nil)
+		return airportSeries.checkRunways(reading, airport)
+	}
+
+	// The wind direction is true, the 2° east declination turns 226° into a magnetic 224°
+	airport := airports.AirportInfo{MagneticVariation: 2, Runways: []airports.Runway{
+		{Name: "13L", Heading: 134, CrosswindLimit: 10},
+		{Name: "31R", Heading: 314, Preferred: true, CrosswindLimit: 10, TailwindLimit: 5, Severity: alerts.SeverityWarning},
+	}}
+	severities := map[string]string{"13L": alerts.SeverityCritical, "31R": alerts.SeverityWarning}
+	firing := func(results []ruleResult) map[string]bool {
+		byRule := make(map[string]bool)
+		for _, result := range results {
+			byRule[result.alert.Rule] = result.firing
+			if runway := result.alert.Rule[strings.Index(result.alert.Rule, "_")+1:]; result.alert.Severity != severities[runway] {
+				t.Errorf("%s alert with severity %s", result.alert.Rule, result.alert.Severity)
+			}
+		}
+		return byRule
+	}
+
+	if components, results := record("wind", 0, 12, airport); len(components) != 0 || len(results) != 0 {
+		t.Errorf("runways evaluated without a wind direction: %v", components)
+	}
+
+	tests := []struct {
+		name             string
+		direction, speed float64
+		magnetic         float64
+		want             map[string]bool
+	}{
+		{"light wind", 226, 3, 224, map[string]bool{"crosswind_13L": false, "crosswind_31R": false, "tailwind_31R": false}},
+		{"crosswind", 226, 12, 224, map[string]bool{"crosswind_13L": true, "crosswind_31R": true, "tailwind_31R": false}},
+		// The tailwind of 13L is not evaluated, the preferred 31R is in use facing the wind
+		{"headwind on the preferred runway", 316, 8, 314, map[string]bool{"crosswind_13L": false, "crosswind_31R": false, "tailwind_31R": false}},
+		{"tailwind on the preferred runway", 136, 8, 134, map[string]bool{"crosswind_13L": false, "crosswind_31R": false, "tailwind_31R": true}},
+	}
+	for i, test := range tests {
+		at := time.Duration(i) * time.Minute
+		record("wind", at, test.speed, airport)
+		components, results := record("wind_direction", at, test.direction, airport)
+		if len(components) != 2 || components[0].WindDirection != test.magnetic || components[0].Heading != 134 {
+			t.Errorf("%s: unexpected runway winds %+v", test.name, components)
+		}
+		if got := firing(results); !reflect.DeepEqual(got, test.want) {
+			t.Errorf("%s: runway alerts %v, want %v", test.name, got, test.want)
+		}
+	}
+}
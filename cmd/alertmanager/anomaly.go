@@ -0,0 +1,176 @@
+package main
+
+import (
+	"ArchiD-Projet/internal/alerts"
+	"fmt"
+	"log"
+	"math"
+	"strconv"
+	"time"
+)
+
+type AnomalyConfig struct {
+	Severity     string                   `yaml:"severity"`
+	Measurements map[string]AnomalyParams `yaml:"measurements"`
+}
+
+type AnomalyParams struct {
+	// Method is either "zscore" (rolling mean and standard deviation over Window)
+	// or "ewma" (exponentially weighted mean and variance with smoothing factor Alpha)
+	Method      string        `yaml:"method"`
+	Window      time.Duration `yaml:"window"`
+	Alpha       float64       `yaml:"alpha"`
+	Warmup      int           `yaml:"warmup"`
+	Sensitivity float64       `yaml:"sensitivity"`
+	// ByHourOfDay keeps a separate baseline for each local hour of the day
+	ByHourOfDay bool `yaml:"byHourOfDay"`
+}
+
+type detector interface {
+	// score returns the deviation of a value from the baseline in standard deviations
+	// and the baseline mean, ok is false while the baseline cannot be used.
+	score(value float64) (z float64, mean float64, ok bool)
+	update(s sample)
+	count() int
+}
+
+type zScoreDetector struct {
+	window  time.Duration
+	samples []sample
+}
+
+func (d *zScoreDetector) score(value float64) (float64, float64, bool) {
+	if len(d.samples) < 2 {
+		return 0, 0, false
+	}
+
+	var sum, sumSquares float64
+	for _, s := range d.samples {
+		sum += s.value
+		sumSquares += s.value * s.value
+	}
+	n := float64(len(d.samples))
+	mean := sum / n
+	variance := (sumSquares - n*mean*mean) / (n - 1)
+	if variance <= 0 {
+		return 0, mean, false
+	}
+
+	return (value - mean) / math.Sqrt(variance), mean, true
+}
+
+func (d *zScoreDetector) update(s sample) {
+	d.samples = append(d.samples, s)
+
+	cutoff := s.time.Add(-d.window)
+	first := 0
+	for first < len(d.samples) && d.samples[first].time.Before(cutoff) {
+		first++
+	}
+	d.samples = d.samples[first:]
+}
+
+func (d *zScoreDetector) count() int {
+	return len(d.samples)
+}
+
+type ewmaDetector struct {
+	alpha    float64
+	mean     float64
+	variance float64
+	n        int
+}
+
+func (d *ewmaDetector) score(value float64) (float64, float64, bool) {
+	if d.n < 2 || d.variance <= 0 {
+		return 0, d.mean, false
+	}
+	return (value - d.mean) / math.Sqrt(d.variance), d.mean, true
+}
+
+func (d *ewmaDetector) update(s sample) {
+	d.n++
+	if d.n == 1 {
+		d.mean = s.value
+		return
+	}
+
+	diff := s.value - d.mean
+	increment := d.alpha * diff
+	d.mean += increment
+	d.variance = (1 - d.alpha) * (d.variance + diff*increment)
+}
+
+func (d *ewmaDetector) count() int {
+	return d.n
+}
+
+type anomalySeries struct {
+	detector detector
+	last     time.Time
+}
+
+func newDetector(params AnomalyParams) (detector, error) {
+	switch params.Method {
+	case "zscore":
+		window := params.Window
+		if window == 0 {
+			window = 24 * time.Hour
+		}
+		return &zScoreDetector{window: window}, nil
+	case "ewma":
+		if params.Alpha <= 0 || params.Alpha >= 1 {
+			return nil, fmt.Errorf("ewma alpha must be between 0 and 1")
+		}
+		return &ewmaDetector{alpha: params.Alpha}, nil
+	default:
+		return nil, fmt.Errorf("unknown anomaly detection method: %s", params.Method)
+	}
+}
+
+// checkAnomaly scores a reading against the baseline of its series before adding it
+// to the baseline. Repeated readings of the same observation are ignored.
+func (m *alertManager) checkAnomaly(reading alerts.Alert, config AnomalyConfig) []ruleResult {
+	params, ok := config.Measurements[reading.Measurement]
+	if !ok {
+		return nil
+	}
+
+	key := seriesKey(reading.Airport, reading.Measurement) + "/" + params.Method
+	if params.ByHourOfDay {
+		key += "/" + strconv.Itoa(m.airportInfo.LocalTime(reading.Airport, reading.Time).Hour())
+	}
+
+	m.anomalyMutex.Lock()
+	defer m.anomalyMutex.Unlock()
+
+	series, ok := m.anomalies[key]
+	if !ok {
+		d, err := newDetector(params)
+		if err != nil {
+			log.Printf("Error creating anomaly detector for %s: %v\n", reading.Measurement, err)
+			return nil
+		}
+		series = &anomalySeries{detector: d}
+		m.anomalies[key] = series
+	}
+
+	if !reading.Time.After(series.last) {
+		return nil
+	}
+	series.last = reading.Time
+
+	z, mean, scored := series.detector.score(reading.Value)
+	warmedUp := series.detector.count() >= params.Warmup
+	series.detector.update(sample{time: reading.Time, value: reading.Value})
+
+	if !scored || !warmedUp {
+		return nil
+	}
+
+	alert := reading
+	alert.Rule = "anomaly"
+	alert.Severity = config.Severity
+	alert.Message = fmt.Sprintf("Anomaly: %s (%f) deviates from its baseline (%f) by %.1f standard deviations", reading.Measurement, reading.Value, mean, z)
+	return []ruleResult{{alert: alert, firing: math.Abs(z) > params.Sensitivity}}
+}
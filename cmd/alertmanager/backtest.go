@@ -0,0 +1,234 @@
+package main
+
+import (
+	"ArchiD-Projet/internal/airports"
+	"ArchiD-Projet/internal/alerts"
+	"ArchiD-Projet/internal/influxstore"
+	"ArchiD-Projet/internal/notifications"
+	"ArchiD-Projet/internal/recordings"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"text/tabwriter"
+	"time"
+)
+
+type BacktestOptions struct {
+	// Source is either "files" (filerecorder recordings in Dir) or "influxdb"
+	Source string
+	Dir    string
+	// Layout of the recordings in Dir, the flat layout by default
+	Layout     *recordings.Layout
+	Thresholds string
+	From       time.Time
+	To         time.Time
+	Airports   []string
+	Format     string
+}
+
+type historicalReading struct {
+	airport string
+	time    time.Time
+	payload string
+}
+
+// BacktestResult summarizes the alerts a rule would have raised at an airport.
+type BacktestResult struct {
+	Airport       string        `json:"airport"`
+	Rule          string        `json:"rule"`
+	Measurement   string        `json:"measurement"`
+	Severity      string        `json:"severity"`
+	Count         int           `json:"count"`
+	Ongoing       int           `json:"ongoing"`
+	TotalDuration time.Duration `json:"totalDuration"`
+	LongestAlert  time.Duration `json:"longestAlert"`
+	FirstAlert    time.Time     `json:"firstAlert"`
+	LastAlert     time.Time     `json:"lastAlert"`
+}
+
+type discardPublisher struct{}
+
+func (discardPublisher) PublishAsync(_ string, _ byte, _ bool, _ interface{}, _ func(error)) {}
+
+// runBacktest replays historical readings through the rules of a threshold file without
+// publishing nor notifying anything, and writes the report of the would-be alerts.
+func runBacktest(options BacktestOptions, airportInfo *airports.Config, output io.Writer) error {
+	thresholds, err := loadThresholds(options.Thresholds)
+	if err != nil {
+		return fmt.Errorf("error loading thresholds: %w", err)
+	}
+
+	dispatcher, err := notifications.NewDispatcher(notifications.Config{})
+	if err != nil {
+		return err
+	}
+	manager := newAlertManager(newAlertState(0), discardPublisher{}, dispatcher, airportInfo, nil)
+	manager.thresholds.Store(thresholds)
+
+	var readings []historicalReading
+	switch options.Source {
+	case "files":
+		readings, err = readRecordings(options)
+	case "influxdb":
+		readings, err = queryReadings(options)
+	default:
+		err = fmt.Errorf("unknown backtest source: %s", options.Source)
+	}
+	if err != nil {
+		return err
+	}
+	if len(readings) == 0 {
+		return fmt.Errorf("no readings found between %s and %s", options.From.Format(time.RFC3339), options.To.Format(time.RFC3339))
+	}
+
+	sort.SliceStable(readings, func(i, j int) bool {
+		return readings[i].time.Before(readings[j].time)
+	})
+	for _, reading := range readings {
+		manager.processMessage("airports/"+reading.airport, []byte(reading.payload))
+	}
+
+	results := summarizeAlerts(manager.state.snapshot(options.To).History, readings[len(readings)-1].time)
+	if options.Format == "json" {
+		encoder := json.NewEncoder(output)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(results)
+	}
+	return writeBacktestReport(output, results, len(readings))
+}
+
+// summarizeAlerts groups the alerts by airport and rule, the alerts still firing at
+// the end of the replay last until the last reading.
+func summarizeAlerts(history []alerts.Alert, end time.Time) []BacktestResult {
+	byKey := make(map[string]*BacktestResult)
+	var keys []string
+
+	for _, alert := range history {
+		key := alert.Airport + "/" + alert.Rule
+		result, ok := byKey[key]
+		if !ok {
+			result = &BacktestResult{Airport: alert.Airport, Rule: alert.Rule, Measurement: alert.Measurement, FirstAlert: alert.StartsAt}
+			byKey[key] = result
+			keys = append(keys, key)
+		}
+
+		endsAt := end
+		if alert.EndsAt != nil {
+			endsAt = *alert.EndsAt
+		} else {
+			result.Ongoing++
+		}
+		duration := endsAt.Sub(alert.StartsAt)
+
+		result.Count++
+		result.TotalDuration += duration
+		if duration > result.LongestAlert {
+			result.LongestAlert = duration
+		}
+		if alerts.SeverityRank(alert.Severity) > alerts.SeverityRank(result.Severity) {
+			result.Severity = alert.Severity
+		}
+		result.LastAlert = alert.StartsAt
+	}
+
+	sort.Strings(keys)
+	results := []BacktestResult{}
+	for _, key := range keys {
+		results = append(results, *byKey[key])
+	}
+	return results
+}
+
+func writeBacktestReport(output io.Writer, results []BacktestResult, readings int) error {
+	writer := tabwriter.NewWriter(output, 0, 0, 2, ' ', 0)
+	fmt.Fprintf(writer, "%d readings replayed, %d airport rules alerting\n\n", readings, len(results))
+	fmt.Fprintln(writer, "AIRPORT\tRULE\tSEVERITY\tALERTS\tONGOING\tTOTAL DURATION\tLONGEST\tFIRST\tLAST")
+	for _, result := range results {
+		fmt.Fprintf(writer, "%s\t%s\t%s\t%d\t%d\t%s\t%s\t%s\t%s\n",
+			result.Airport, result.Rule, result.Severity, result.Count, result.Ongoing,
+			result.TotalDuration, result.LongestAlert,
+			result.FirstAlert.Format("2006-01-02 15:04"), result.LastAlert.Format("2006-01-02 15:04"))
+	}
+	return writer.Flush()
+}
+
+// parseBacktestTime accepts a date, read in the sensor time zone, or an RFC3339 time.
+func parseBacktestTime(value string) (time.Time, error) {
+	if value == "" {
+		return time.Time{}, fmt.Errorf("missing date")
+	}
+	day, err := time.ParseInLocation("2006-01-02", value, sensorZone)
+	if err == nil {
+		return day, nil
+	}
+	return time.Parse(time.RFC3339, value)
+}
+
+// readRecordings reads the daily files written by the filerecorder under Dir, in any
+// format, compressed or not.
+func readRecordings(options BacktestOptions) ([]historicalReading, error) {
+	layout := options.Layout
+	if layout == nil {
+		var err error
+		layout, err = recordings.NewLayout(recordings.DefaultPathTemplate, false, "")
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	files, err := recordings.Find(options.Dir, layout, options.From, options.To, options.Airports)
+	if err != nil {
+		return nil, err
+	}
+
+	var readings []historicalReading
+	for _, file := range files {
+		fileReadings, err := readRecording(file.Path, file.Airport, options)
+		if err != nil {
+			return nil, fmt.Errorf("error reading %s: %w", file.Path, err)
+		}
+		readings = append(readings, fileReadings...)
+	}
+	return readings, nil
+}
+
+func readRecording(filename string, airport string, options BacktestOptions) ([]historicalReading, error) {
+	records, err := recordings.ReadFile(filename, airport)
+	if err != nil {
+		return nil, err
+	}
+
+	var readings []historicalReading
+	for _, record := range records {
+		if record.Time.Before(options.From) || !record.Time.Before(options.To) {
+			continue
+		}
+		timestamp := record.Time.In(sensorZone)
+		payload := fmt.Sprintf("%s %s %f", timestamp.Format("2006-01-02 15:04:05"), record.Measurement, record.Value)
+		readings = append(readings, historicalReading{airport: airport, time: timestamp, payload: payload})
+	}
+	return readings, nil
+}
+
+// queryReadings reads the points written by the databaserecorder.
+func queryReadings(options BacktestOptions) ([]historicalReading, error) {
+	client, err := influxstore.NewClient()
+	if err != nil {
+		return nil, err
+	}
+	defer client.Close()
+
+	points, err := client.Query(options.From, options.To, options.Airports, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	var readings []historicalReading
+	for _, point := range points {
+		timestamp := point.Time.In(sensorZone)
+		payload := fmt.Sprintf("%s %s %f", timestamp.Format("2006-01-02 15:04:05"), point.Measurement, point.Value)
+		readings = append(readings, historicalReading{airport: point.Airport, time: timestamp, payload: payload})
+	}
+	return readings, nil
+}
@@ -0,0 +1,207 @@
+package main
+
+import (
+	"ArchiD-Projet/internal/alerts"
+	"fmt"
+	"github.com/Knetic/govaluate"
+	"log"
+	"math"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+)
+
+const defaultMaxAge = 15 * time.Minute
+
+// The measurements of change() are string arguments, not variables of the expression.
+var changePattern = regexp.MustCompile(`change\(\s*['"]([^'"]+)['"]`)
+
+type CompositeRule struct {
+	Name       string        `yaml:"name"`
+	Expression string        `yaml:"expression"`
+	MaxAge     time.Duration `yaml:"maxAge"`
+	Severity   string        `yaml:"severity"`
+}
+
+// checkComposite evaluates the composite rules using the reading of one measurement
+// and the latest values of the other measurements of the same airport. A rule is
+// evaluated on the readings of its variables and of the measurements of its change().
+// The caller must hold the airport mutex.
+func (airportSeries *airportWindows) checkComposite(reading alerts.Alert, rules []CompositeRule) []ruleResult {
+	airportSeries.now = reading.Time
+
+	var results []ruleResult
+	for _, rule := range rules {
+		expression, err := airportSeries.expression(rule.Expression)
+		if err != nil {
+			log.Printf("Error parsing composite rule %s: %v\n", rule.Name, err)
+			continue
+		}
+
+		variables := expression.Vars()
+		inputs := compositeInputs(rule.Expression, variables)
+		if !containsString(inputs, reading.Measurement) {
+			continue
+		}
+
+		maxAge := rule.MaxAge
+		if maxAge == 0 {
+			maxAge = defaultMaxAge
+		}
+
+		// A rule is only evaluated when all its inputs are fresh enough
+		parameters := airportSeries.latestValues(reading, maxAge)
+		if !hasParameters(parameters, inputs) {
+			continue
+		}
+
+		result, err := expression.Evaluate(parameters)
+		if err != nil {
+			log.Printf("Error evaluating composite rule %s: %v\n", rule.Name, err)
+			continue
+		}
+
+		fired, ok := result.(bool)
+		if !ok {
+			log.Printf("Composite rule %s does not evaluate to a boolean\n", rule.Name)
+			continue
+		}
+
+		alert := reading
+		alert.Measurement = "composite"
+		alert.Rule = rule.Name
+		alert.Severity = rule.Severity
+		alert.Message = fmt.Sprintf("Alert: %s (%s)", rule.Name, formatParameters(parameters, inputs))
+		results = append(results, ruleResult{alert: alert, firing: fired})
+	}
+	return results
+}
+
+func (airportSeries *airportWindows) expression(text string) (*govaluate.EvaluableExpression, error) {
+	expression, ok := airportSeries.expressions[text]
+	if ok {
+		return expression, nil
+	}
+
+	expression, err := govaluate.NewEvaluableExpressionWithFunctions(text, airportSeries.compositeFunctions())
+	if err != nil {
+		return nil, err
+	}
+	airportSeries.expressions[text] = expression
+	return expression, nil
+}
+
+func (airportSeries *airportWindows) latestValues(reading alerts.Alert, maxAge time.Duration) map[string]interface{} {
+	parameters := make(map[string]interface{})
+	for measurement, window := range airportSeries.series {
+		if len(window.samples) == 0 {
+			continue
+		}
+		latest := window.latest()
+		if reading.Time.Sub(latest.time) <= maxAge {
+			parameters[measurement] = latest.value
+		}
+	}
+	return parameters
+}
+
+func (airportSeries *airportWindows) compositeFunctions() map[string]govaluate.ExpressionFunction {
+	return map[string]govaluate.ExpressionFunction{
+		"abs": func(args ...interface{}) (interface{}, error) {
+			if len(args) != 1 {
+				return nil, fmt.Errorf("abs expects 1 argument")
+			}
+			value, ok := args[0].(float64)
+			if !ok {
+				return nil, fmt.Errorf("abs expects a number")
+			}
+			return math.Abs(value), nil
+		},
+		"windchill": func(args ...interface{}) (interface{}, error) {
+			if len(args) != 2 {
+				return nil, fmt.Errorf("windchill expects 2 arguments")
+			}
+			temperature, ok1 := args[0].(float64)
+			wind, ok2 := args[1].(float64)
+			if !ok1 || !ok2 {
+				return nil, fmt.Errorf("windchill expects numbers")
+			}
+			return windChill(temperature, wind), nil
+		},
+		"change": func(args ...interface{}) (interface{}, error) {
+			if len(args) != 2 {
+				return nil, fmt.Errorf("change expects 2 arguments")
+			}
+			measurement, ok1 := args[0].(string)
+			period, ok2 := args[1].(string)
+			if !ok1 || !ok2 {
+				return nil, fmt.Errorf("change expects a measurement and a duration")
+			}
+			duration, err := time.ParseDuration(period)
+			if err != nil {
+				return nil, err
+			}
+			window, ok := airportSeries.series[measurement]
+			if !ok || len(window.samples) == 0 {
+				return nil, fmt.Errorf("no data for %s", measurement)
+			}
+			return window.latest().value - window.oldest(airportSeries.now.Add(-duration)).value, nil
+		},
+	}
+}
+
+// windChill returns the wind chill temperature in Kelvin for a temperature in Kelvin
+// and a wind speed in m/s, using the Environment Canada formula.
+func windChill(temperature float64, wind float64) float64 {
+	celsius := temperature - 273.15
+	speed := wind * 3.6
+
+	if celsius > 10 || speed < 4.8 {
+		return temperature
+	}
+
+	factor := math.Pow(speed, 0.16)
+	return 13.12 + 0.6215*celsius - 11.37*factor + 0.3965*celsius*factor + 273.15
+}
+
+// compositeInputs returns the variables of an expression and the measurements of its
+// change() calls.
+func compositeInputs(text string, variables []string) []string {
+	inputs := append([]string(nil), variables...)
+	for _, match := range changePattern.FindAllStringSubmatch(text, -1) {
+		if !containsString(inputs, match[1]) {
+			inputs = append(inputs, match[1])
+		}
+	}
+	return inputs
+}
+
+func containsString(list []string, value string) bool {
+	for _, item := range list {
+		if item == value {
+			return true
+		}
+	}
+	return false
+}
+
+func hasParameters(parameters map[string]interface{}, variables []string) bool {
+	for _, variable := range variables {
+		if _, ok := parameters[variable]; !ok {
+			return false
+		}
+	}
+	return true
+}
+
+func formatParameters(parameters map[string]interface{}, variables []string) string {
+	sorted := append([]string(nil), variables...)
+	sort.Strings(sorted)
+
+	var values []string
+	for _, variable := range sorted {
+		values = append(values, fmt.Sprintf("%s=%f", variable, parameters[variable]))
+	}
+	return strings.Join(values, ", ")
+}
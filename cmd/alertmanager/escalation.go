@@ -0,0 +1,94 @@
+package main
+
+import (
+	"ArchiD-Projet/internal/alerts"
+	"ArchiD-Projet/internal/notifications"
+	"fmt"
+	"log"
+	"time"
+)
+
+const escalationInterval = 10 * time.Second
+
+// escalation tracks the escalation notifications sent for a firing alert.
+type escalation struct {
+	policy  notifications.EscalationPolicy
+	started time.Time
+	sent    int
+}
+
+// checkEscalations sends the escalation steps that are due for the firing alerts that
+// are neither silenced nor acknowledged. An acknowledgement stops the escalation, it
+// starts over if the acknowledgement is cleared by a higher severity.
+func (m *alertManager) checkEscalations(firing []alerts.Alert, now time.Time) {
+	pending := make(map[string]bool)
+	for _, alert := range firing {
+		if alert.Silenced || alert.Acknowledgement != nil {
+			continue
+		}
+		pending[alert.ID] = true
+
+		progress, ok := m.escalations[alert.ID]
+		if !ok {
+			policy, ok := m.dispatcher.Escalation(alert)
+			if !ok {
+				continue
+			}
+			// The delays run from the notification of the alert, which is part of the
+			// published state, so they survive a restart or a change of leader
+			started := alert.NotifiedAt
+			if started.IsZero() {
+				started = now
+			}
+			progress = &escalation{policy: policy, started: started}
+			m.escalations[alert.ID] = progress
+		}
+
+		// Only the latest due step is sent, the steps that fell due while no instance
+		// was escalating the alert are skipped
+		var due *notifications.EscalationStep
+		for {
+			step, after, ok := progress.policy.Next(progress.sent)
+			if !ok || now.Before(progress.started.Add(after)) {
+				break
+			}
+			progress.sent++
+			due = &step
+		}
+		if due != nil {
+			m.sendEscalation(alert, progress, *due, now)
+		}
+	}
+
+	for id := range m.escalations {
+		if !pending[id] {
+			delete(m.escalations, id)
+		}
+	}
+}
+
+// sendEscalation only notifies from the leader, the followers keep track of the
+// escalations to continue them if they take over.
+func (m *alertManager) sendEscalation(alert alerts.Alert, progress *escalation, step notifications.EscalationStep, now time.Time) {
+	if !m.election.isLeader() {
+		return
+	}
+
+	alert.Message = fmt.Sprintf("Escalation %s (step %d, unacknowledged for %s): %s", progress.policy.Name, progress.sent, now.Sub(progress.started).Round(time.Minute), alert.Message)
+
+	go func() {
+		err := m.dispatcher.NotifyTargets(alert, step.Targets, now)
+		if err != nil {
+			log.Println("Error sending escalation:", err)
+		}
+	}()
+}
+
+func (m *alertManager) runEscalations() {
+	ticker := time.NewTicker(escalationInterval)
+	defer ticker.Stop()
+
+	for now := range ticker.C {
+		m.checkEscalations(m.state.firing(), now)
+	}
+}
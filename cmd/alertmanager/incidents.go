@@ -0,0 +1,244 @@
+package main
+
+import (
+	"ArchiD-Projet/internal/alerts"
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Number of incidents kept in the published state.
+const incidentHistorySize = 100
+
+const incidentUpdateCheckInterval = 10 * time.Second
+
+type IncidentConfig struct {
+	// Window groups an alert into the latest incident of its airport when the incident
+	// has firing alerts or changed less than Window before, 0 disables the grouping.
+	Window time.Duration `yaml:"window"`
+	// UpdateInterval is the minimum delay between two notifications of an incident
+	UpdateInterval time.Duration `yaml:"updateInterval"`
+}
+
+// incidentUpdate is the notification of an incident with the alerts of its timeline,
+// the sinks are matched against these alerts and not the incident rule.
+type incidentUpdate struct {
+	notification alerts.Alert
+	members      []alerts.Alert
+}
+
+type incidentEntry struct {
+	incident     alerts.Incident
+	firing       map[string]bool
+	lastActivity time.Time
+	notified     time.Time
+	pending      bool
+}
+
+func (s *alertState) configureIncidents(config IncidentConfig) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.incidentConfig = config
+}
+
+// addIncidentEvent adds a member alert event to the incident of the alert, the alert
+// joins the latest incident of its airport or opens a new one when it starts firing.
+// The caller must hold the state mutex.
+func (s *alertState) addIncidentEvent(alert *alerts.Alert) {
+	if s.incidentConfig.Window == 0 {
+		return
+	}
+
+	entry := s.latestIncidents[alert.Airport]
+	if alert.IncidentID == "" {
+		if entry == nil || (len(entry.firing) == 0 && alert.Time.Sub(entry.lastActivity) > s.incidentConfig.Window) {
+			entry = s.openIncident(alert)
+		}
+		alert.IncidentID = entry.incident.ID
+	} else if entry == nil || entry.incident.ID != alert.IncidentID {
+		entry = s.findIncident(alert.IncidentID)
+		if entry == nil {
+			return
+		}
+	}
+
+	if alert.Status == alerts.StatusFiring {
+		entry.firing[alert.ID] = true
+	} else {
+		delete(entry.firing, alert.ID)
+	}
+
+	message := alert.Message
+	if alert.Status == alerts.StatusResolved {
+		message = fmt.Sprintf("Resolved: %s (%f)", alert.Rule, alert.Value)
+	}
+
+	incident := &entry.incident
+	incident.Timeline = append(incident.Timeline, alerts.IncidentEvent{
+		Time:        alert.Time,
+		AlertID:     alert.ID,
+		Measurement: alert.Measurement,
+		Rule:        alert.Rule,
+		Severity:    alert.Severity,
+		Status:      alert.Status,
+		Message:     message,
+	})
+	if alerts.SeverityRank(alert.Severity) > alerts.SeverityRank(incident.Severity) {
+		incident.Severity = alert.Severity
+	}
+
+	if len(entry.firing) == 0 {
+		endsAt := alert.Time
+		incident.Status = alerts.IncidentResolved
+		incident.EndsAt = &endsAt
+	} else {
+		incident.Status = alerts.IncidentOpen
+		incident.EndsAt = nil
+	}
+
+	entry.lastActivity = alert.Time
+	if !alert.Silenced {
+		entry.pending = true
+	}
+}
+
+func (s *alertState) openIncident(alert *alerts.Alert) *incidentEntry {
+	entry := &incidentEntry{
+		incident: alerts.Incident{
+			ID:       alerts.NewID(),
+			Airport:  alert.Airport,
+			Status:   alerts.IncidentOpen,
+			StartsAt: alert.Time,
+		},
+		firing: make(map[string]bool),
+	}
+
+	s.latestIncidents[alert.Airport] = entry
+	s.incidents = append(s.incidents, entry)
+	if len(s.incidents) > incidentHistorySize {
+		s.incidents = s.incidents[len(s.incidents)-incidentHistorySize:]
+	}
+	return entry
+}
+
+func (s *alertState) findIncident(id string) *incidentEntry {
+	for _, entry := range s.incidents {
+		if entry.incident.ID == id {
+			return entry
+		}
+	}
+	return nil
+}
+
+// incidentNotifications returns the notifications of the incidents that changed, an
+// incident is notified when it opens then at most once per update interval.
+func (s *alertState) incidentNotifications(now time.Time) []incidentUpdate {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	var notifications []incidentUpdate
+	for _, entry := range s.incidents {
+		if !entry.pending || (!entry.notified.IsZero() && now.Sub(entry.notified) < s.incidentConfig.UpdateInterval) {
+			continue
+		}
+
+		notifications = append(notifications, incidentUpdate{notification: incidentNotification(entry, now), members: incidentMembers(entry.incident)})
+		entry.notified = now
+		entry.pending = false
+	}
+	return notifications
+}
+
+func incidentNotification(entry *incidentEntry, now time.Time) alerts.Alert {
+	incident := entry.incident
+
+	rules := make(map[string]bool)
+	for _, event := range incident.Timeline {
+		rules[event.Rule] = true
+	}
+	var names []string
+	for rule := range rules {
+		names = append(names, rule)
+	}
+	sort.Strings(names)
+
+	var message string
+	switch {
+	case incident.Status == alerts.IncidentResolved:
+		message = fmt.Sprintf("Incident resolved at %s after %s (%s)", incident.Airport, incident.EndsAt.Sub(incident.StartsAt).Round(time.Minute), strings.Join(names, ", "))
+	case entry.notified.IsZero():
+		message = fmt.Sprintf("Incident opened at %s: %s", incident.Airport, strings.Join(names, ", "))
+	default:
+		message = fmt.Sprintf("Incident update at %s: %d alerts firing (%s)", incident.Airport, len(entry.firing), strings.Join(names, ", "))
+	}
+
+	status := alerts.StatusFiring
+	if incident.Status == alerts.IncidentResolved {
+		status = alerts.StatusResolved
+	}
+
+	return alerts.Alert{
+		ID:          incident.ID,
+		Airport:     incident.Airport,
+		Measurement: "incident",
+		Rule:        "incident",
+		Severity:    incident.Severity,
+		Status:      status,
+		Value:       float64(len(entry.firing)),
+		Message:     message,
+		Time:        now,
+		StartsAt:    incident.StartsAt,
+		EndsAt:      incident.EndsAt,
+		IncidentID:  incident.ID,
+	}
+}
+
+// incidentMembers returns an alert per event of the incident timeline.
+func incidentMembers(incident alerts.Incident) []alerts.Alert {
+	members := make([]alerts.Alert, len(incident.Timeline))
+	for i, event := range incident.Timeline {
+		members[i] = alerts.Alert{
+			ID:          event.AlertID,
+			Airport:     incident.Airport,
+			Measurement: event.Measurement,
+			Rule:        event.Rule,
+			Severity:    event.Severity,
+			Status:      event.Status,
+			Time:        event.Time,
+			IncidentID:  incident.ID,
+		}
+	}
+	return members
+}
+
+func (m *alertManager) notifyIncidents(now time.Time) {
+	for _, update := range m.state.incidentNotifications(now) {
+		m.dispatchNotification(update.notification, update.members)
+	}
+}
+
+// runIncidentUpdates sends the updates that were held back by the update interval.
+func (m *alertManager) runIncidentUpdates() {
+	ticker := time.NewTicker(incidentUpdateCheckInterval)
+	defer ticker.Stop()
+
+	for now := range ticker.C {
+		m.notifyIncidents(now)
+	}
+}
+
+// dispatchNotification sends a notification to the sinks matching one of its members.
+func (m *alertManager) dispatchNotification(alert alerts.Alert, members []alerts.Alert) {
+	if !m.election.isLeader() {
+		return
+	}
+
+	go func() {
+		err := m.dispatcher.NotifyGroup(alert, members)
+		if err != nil {
+			log.Println("Error sending notifications:", err)
+		}
+	}()
+}
@@ -0,0 +1,157 @@
+package main
+
+import (
+	"encoding/json"
+	mqtt "github.com/eclipse/paho.mqtt.golang"
+	"log"
+	"sync"
+	"time"
+)
+
+// lease is the retained message of the leader lease topic. The leader renews it at each
+// heartbeat and releases it, with an empty instance, when it stops.
+type lease struct {
+	Instance  string    `json:"instance"`
+	ExpiresAt time.Time `json:"expiresAt"`
+}
+
+// leaderElection elects one active alert manager among the instances sharing the lease
+// topic. Every instance evaluates the rules and follows the state published by the
+// leader, but only the leader publishes and notifies.
+type leaderElection struct {
+	mutex             sync.Mutex
+	instance          string
+	leaseDuration     time.Duration
+	heartbeatInterval time.Duration
+	leader            bool
+	// Latest lease of another instance and when it was received, the local reception
+	// time is used so that the clocks of the instances do not need to agree
+	other     lease
+	otherSeen time.Time
+	client    leasePublisher
+}
+
+// leasePublisher waits for the lease to be sent, so a release is sent before the
+// client disconnects.
+type leasePublisher interface {
+	Publish(topic string, qos byte, retained bool, payload interface{}) error
+}
+
+func newLeaderElection(instance string, leaseDuration time.Duration, heartbeatInterval time.Duration, client leasePublisher) *leaderElection {
+	return &leaderElection{instance: instance, leaseDuration: leaseDuration, heartbeatInterval: heartbeatInterval, client: client}
+}
+
+// Without leader election, a nil election, the instance is always the leader.
+func (e *leaderElection) isLeader() bool {
+	if e == nil {
+		return true
+	}
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+	return e.leader
+}
+
+// receive records the lease of another instance. When two instances claim the lease
+// at the same time, the one with the lowest name keeps it.
+func (e *leaderElection) receive(l lease, now time.Time) {
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+
+	if l.Instance == e.instance {
+		return
+	}
+	e.other = l
+	e.otherSeen = now
+
+	if e.leader && l.Instance != "" && l.Instance < e.instance {
+		e.leader = false
+		log.Printf("Instance %s takes over, %s steps down\n", l.Instance, e.instance)
+	}
+}
+
+// tick returns the lease to publish, if any, and whether the instance has just become
+// the leader. A follower claims the lease when no other instance renewed it in time.
+func (e *leaderElection) tick(now time.Time) (lease, bool, bool) {
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+
+	own := lease{Instance: e.instance, ExpiresAt: now.Add(e.leaseDuration)}
+	if e.leader {
+		return own, true, false
+	}
+
+	if e.other.Instance != "" && now.Sub(e.otherSeen) < e.leaseDuration {
+		return lease{}, false, false
+	}
+
+	e.leader = true
+	log.Printf("Instance %s is now the leader\n", e.instance)
+	return own, true, true
+}
+
+func (e *leaderElection) onLeaseReceived(_ mqtt.Client, message mqtt.Message) {
+	var received lease
+	err := json.Unmarshal(message.Payload(), &received)
+	if err != nil {
+		log.Println("Error decoding leader lease:", err)
+		return
+	}
+	e.receive(received, time.Now())
+}
+
+func (e *leaderElection) run(onPromoted func()) {
+	ticker := time.NewTicker(e.heartbeatInterval)
+	defer ticker.Stop()
+
+	for now := range ticker.C {
+		l, publish, promoted := e.tick(now)
+		if !publish {
+			continue
+		}
+
+		err := e.publishLease(l)
+		if err != nil {
+			log.Println("Error renewing leader lease:", err)
+		}
+		if promoted {
+			onPromoted()
+		}
+	}
+}
+
+// release hands the lease over to the other instances without waiting for it to expire.
+func (e *leaderElection) release() {
+	e.mutex.Lock()
+	wasLeader := e.leader
+	e.leader = false
+	e.mutex.Unlock()
+
+	if !wasLeader {
+		return
+	}
+	err := e.publishLease(lease{})
+	if err != nil {
+		log.Println("Error releasing leader lease:", err)
+	}
+}
+
+func (e *leaderElection) publishLease(l lease) error {
+	payload, err := json.Marshal(l)
+	if err != nil {
+		return err
+	}
+	return e.client.Publish(LEADER_TOPIC, 1, true, payload)
+}
+
+// leaderPublisher drops the publications of a follower.
+type leaderPublisher struct {
+	publisher publisher
+	election  *leaderElection
+}
+
+func (p leaderPublisher) PublishAsync(topic string, qos byte, retained bool, payload interface{}, onError func(error)) {
+	if !p.election.isLeader() {
+		return
+	}
+	p.publisher.PublishAsync(topic, qos, retained, payload, onError)
+}
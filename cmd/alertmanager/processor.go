@@ -0,0 +1,100 @@
+package main
+
+import (
+	brokerutils "ArchiD-Projet/internal/brokerUtils"
+	mqtt "github.com/eclipse/paho.mqtt.golang"
+	"hash/fnv"
+	"log"
+	"sync"
+	"sync/atomic"
+)
+
+type incomingMessage struct {
+	topic   string
+	payload []byte
+}
+
+// processor spreads messages over workers with bounded queues. All messages of an
+// airport go to the same worker so they are processed in the order they arrived.
+type processor struct {
+	queues    []chan incomingMessage
+	handle    func(topic string, payload []byte)
+	waitGroup sync.WaitGroup
+	// A submit holds closing for reading, so close never closes a queue it sends on
+	closing sync.RWMutex
+	closed  bool
+}
+
+type publisher interface {
+	PublishAsync(topic string, qos byte, retained bool, payload interface{}, onError func(error))
+}
+
+var publishFailures atomic.Int64
+
+func newProcessor(workers int, queueSize int, handle func(topic string, payload []byte)) *processor {
+	if workers < 1 {
+		workers = 1
+	}
+
+	p := &processor{handle: handle}
+	for i := 0; i < workers; i++ {
+		queue := make(chan incomingMessage, queueSize)
+		p.queues = append(p.queues, queue)
+
+		p.waitGroup.Add(1)
+		go p.work(queue)
+	}
+	return p
+}
+
+func (p *processor) work(queue chan incomingMessage) {
+	defer p.waitGroup.Done()
+	for message := range queue {
+		p.handle(message.topic, message.payload)
+	}
+}
+
+// submit queues a message on the worker of its airport, it blocks while that queue
+// is full so a slow worker slows down the subscription instead of losing messages.
+// Messages submitted after close are dropped.
+func (p *processor) submit(airport string, message incomingMessage) {
+	p.closing.RLock()
+	defer p.closing.RUnlock()
+	if p.closed {
+		log.Printf("Message of %s received after shutdown, dropped\n", airport)
+		return
+	}
+
+	hash := fnv.New32a()
+	hash.Write([]byte(airport))
+	queue := p.queues[hash.Sum32()%uint32(len(p.queues))]
+
+	select {
+	case queue <- message:
+	default:
+		log.Printf("Queue full for airport %s, waiting\n", airport)
+		queue <- message
+	}
+}
+
+func (p *processor) onMessageReceived(_ mqtt.Client, message mqtt.Message) {
+	p.submit(brokerutils.GetAirportCodeFromTopic(message.Topic()), incomingMessage{topic: message.Topic(), payload: message.Payload()})
+}
+
+// close stops accepting messages and waits for the queued ones to be processed.
+func (p *processor) close() {
+	p.closing.Lock()
+	p.closed = true
+	for _, queue := range p.queues {
+		close(queue)
+	}
+	p.closing.Unlock()
+	p.waitGroup.Wait()
+}
+
+func onPublishError(topic string) func(error) {
+	return func(err error) {
+		publishFailures.Add(1)
+		log.Printf("Error publishing to %s: %v\n", topic, err)
+	}
+}
@@ -0,0 +1,102 @@
+package main
+
+import (
+	"ArchiD-Projet/internal/airports"
+	"ArchiD-Projet/internal/alerts"
+	"encoding/json"
+	"fmt"
+	"log"
+	"math"
+	"time"
+)
+
+// Wind speed and direction older than this are not combined.
+const runwayWindMaxAge = 15 * time.Minute
+
+type RunwayWind struct {
+	Airport       string    `json:"airport"`
+	Runway        string    `json:"runway"`
+	Heading       float64   `json:"heading"`
+	WindDirection float64   `json:"windDirection"`
+	WindSpeed     float64   `json:"windSpeed"`
+	Headwind      float64   `json:"headwind"`
+	Crosswind     float64   `json:"crosswind"`
+	Time          time.Time `json:"time"`
+}
+
+// windComponents splits a wind blowing from a magnetic direction into its headwind
+// component (negative for a tailwind) and crosswind component (positive from the right)
+// for a runway heading.
+func windComponents(heading float64, direction float64, speed float64) (float64, float64) {
+	angle := (direction - heading) * math.Pi / 180
+	return speed * math.Cos(angle), speed * math.Sin(angle)
+}
+
+// checkRunways computes the wind components of every runway of the airport from the
+// latest wind speed and direction. The caller must hold the airport mutex.
+func (airportSeries *airportWindows) checkRunways(reading alerts.Alert, airport airports.AirportInfo) ([]RunwayWind, []ruleResult) {
+	if reading.Measurement != "wind" && reading.Measurement != "wind_direction" {
+		return nil, nil
+	}
+
+	values := airportSeries.latestValues(reading, runwayWindMaxAge)
+	speed, ok1 := values["wind"].(float64)
+	trueDirection, ok2 := values["wind_direction"].(float64)
+	if !ok1 || !ok2 {
+		return nil, nil
+	}
+	direction := math.Mod(trueDirection-airport.MagneticVariation+360, 360)
+
+	var components []RunwayWind
+	var results []ruleResult
+	for _, runway := range airport.Runways {
+		headwind, crosswind := windComponents(runway.Heading, direction, speed)
+		components = append(components, RunwayWind{
+			Airport:       reading.Airport,
+			Runway:        runway.Name,
+			Heading:       runway.Heading,
+			WindDirection: direction,
+			WindSpeed:     speed,
+			Headwind:      headwind,
+			Crosswind:     crosswind,
+			Time:          reading.Time,
+		})
+
+		alert := reading
+		alert.Measurement = "wind"
+		alert.Value = speed
+		alert.Severity = runway.Severity
+		if alert.Severity == "" {
+			alert.Severity = alerts.SeverityCritical
+		}
+
+		if runway.CrosswindLimit > 0 {
+			crosswindAlert := alert
+			crosswindAlert.Rule = "crosswind_" + runway.Name
+			crosswindAlert.Message = fmt.Sprintf("Alert: Crosswind on runway %s (%f) exceeded limit (%f)", runway.Name, math.Abs(crosswind), runway.CrosswindLimit)
+			results = append(results, ruleResult{alert: crosswindAlert, firing: math.Abs(crosswind) > runway.CrosswindLimit})
+		}
+		// Only a preferred runway is kept in use with a tailwind, the reciprocal of
+		// a runway facing the wind has a tailwind but is not in use
+		if runway.Preferred && runway.TailwindLimit > 0 {
+			tailwindAlert := alert
+			tailwindAlert.Rule = "tailwind_" + runway.Name
+			tailwindAlert.Message = fmt.Sprintf("Alert: Tailwind on runway %s (%f) exceeded limit (%f)", runway.Name, -headwind, runway.TailwindLimit)
+			results = append(results, ruleResult{alert: tailwindAlert, firing: -headwind > runway.TailwindLimit})
+		}
+	}
+	return components, results
+}
+
+func (m *alertManager) publishRunwayWinds(components []RunwayWind) {
+	for _, component := range components {
+		payload, err := json.Marshal(component)
+		if err != nil {
+			log.Println("Error encoding runway wind:", err)
+			continue
+		}
+
+		topic := RUNWAY_TOPIC + component.Airport + "/" + component.Runway
+		m.publisher.PublishAsync(topic, 1, true, payload, onPublishError(topic))
+	}
+}
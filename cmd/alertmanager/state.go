@@ -0,0 +1,383 @@
+package main
+
+import (
+	"ArchiD-Projet/internal/alerts"
+	"encoding/json"
+	"fmt"
+	mqtt "github.com/eclipse/paho.mqtt.golang"
+	"gopkg.in/yaml.v3"
+	"log"
+	"os"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Number of alerts kept in the published history.
+const historySize = 500
+
+type alertState struct {
+	mutex    sync.Mutex
+	silences []alerts.Silence
+	// Firing alerts by key, they are also referenced by the history
+	active  map[string]*alerts.Alert
+	history []*alerts.Alert
+	// Maximum number of alerts kept in the history, 0 keeps them all
+	maxHistory int
+	// Last notification of the firing alerts by key, a firing alert is notified again
+	// after repeatInterval, never when it is 0
+	notified       map[string]time.Time
+	repeatInterval time.Duration
+
+	incidentConfig  IncidentConfig
+	incidents       []*incidentEntry
+	latestIncidents map[string]*incidentEntry
+}
+
+type SilenceConfig struct {
+	Silences []alerts.Silence `yaml:"silences"`
+}
+
+func newAlertState(maxHistory int) *alertState {
+	return &alertState{active: make(map[string]*alerts.Alert), maxHistory: maxHistory, notified: make(map[string]time.Time), latestIncidents: make(map[string]*incidentEntry)}
+}
+
+func (s *alertState) configureRepeatInterval(interval time.Duration) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.repeatInterval = interval
+}
+
+func loadSilences(filename string) ([]alerts.Silence, error) {
+	var config SilenceConfig
+
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+
+	err = yaml.Unmarshal(data, &config)
+	if err != nil {
+		return nil, err
+	}
+
+	for i := range config.Silences {
+		if config.Silences[i].ID == "" {
+			config.Silences[i].ID = alerts.NewID()
+		}
+		err = config.Silences[i].Validate()
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return config.Silences, nil
+}
+
+func (s *alertState) addSilence(silence alerts.Silence) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	for i, existing := range s.silences {
+		if existing.ID == silence.ID {
+			s.silences[i] = silence
+			return
+		}
+	}
+	s.silences = append(s.silences, silence)
+}
+
+func (s *alertState) isSilenced(alert alerts.Alert, now time.Time) bool {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	for _, silence := range s.silences {
+		if silence.ActiveAt(now) && silence.Matches(alert) {
+			return true
+		}
+	}
+	return false
+}
+
+// fire records a firing evaluation of a rule and returns the alert as stored in the
+// state, and whether it should be notified. A firing alert is notified when it starts,
+// when its severity escalates, when its silence ends and every repeat interval, unless
+// it is silenced or acknowledged. An escalation clears the acknowledgement.
+func (s *alertState) fire(alert alerts.Alert, now time.Time) (alerts.Alert, bool) {
+	silenced := s.isSilenced(alert, now)
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	existing, ok := s.active[alert.Key()]
+	if !ok {
+		alert.ID = alerts.NewID()
+		alert.Status = alerts.StatusFiring
+		alert.StartsAt = alert.Time
+		alert.Silenced = silenced
+		s.addIncidentEvent(&alert)
+
+		s.active[alert.Key()] = &alert
+		s.history = append(s.history, &alert)
+		if s.maxHistory > 0 && len(s.history) > s.maxHistory {
+			s.history = s.history[len(s.history)-s.maxHistory:]
+		}
+		if silenced {
+			return alert, false
+		}
+		alert.NotifiedAt = now
+		s.notified[alert.Key()] = now
+		return alert, true
+	}
+
+	escalated := alerts.SeverityRank(alert.Severity) > alerts.SeverityRank(existing.Severity)
+	unacknowledged := escalated && existing.Acknowledgement != nil
+	if escalated {
+		existing.Acknowledgement = nil
+	}
+	unsilenced := existing.Silenced && !silenced
+	if (unsilenced || unacknowledged || existing.NotifiedAt.IsZero()) && !silenced {
+		existing.NotifiedAt = now
+	}
+	existing.Severity = alert.Severity
+	existing.Value = alert.Value
+	existing.Message = alert.Message
+	existing.Time = alert.Time
+	existing.Silenced = silenced
+	if escalated {
+		s.addIncidentEvent(existing)
+	}
+
+	if silenced || existing.Acknowledgement != nil {
+		return *existing, false
+	}
+	last, ok := s.notified[alert.Key()]
+	repeat := s.repeatInterval > 0 && (!ok || now.Sub(last) >= s.repeatInterval)
+	if !escalated && !unsilenced && !repeat {
+		return *existing, false
+	}
+	s.notified[alert.Key()] = now
+	return *existing, true
+}
+
+// resolve closes the firing alert with the same key, if any, and returns it.
+func (s *alertState) resolve(alert alerts.Alert) (alerts.Alert, bool) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	existing, ok := s.active[alert.Key()]
+	if !ok {
+		return alerts.Alert{}, false
+	}
+
+	endsAt := alert.Time
+	existing.Status = alerts.StatusResolved
+	existing.EndsAt = &endsAt
+	existing.Value = alert.Value
+	existing.Time = alert.Time
+	s.addIncidentEvent(existing)
+	delete(s.active, alert.Key())
+	delete(s.notified, alert.Key())
+
+	return *existing, true
+}
+
+func (s *alertState) acknowledge(ack alerts.Acknowledgement) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	for _, alert := range s.active {
+		if alert.ID == ack.AlertID {
+			alert.Acknowledgement = &ack
+			return nil
+		}
+	}
+	return fmt.Errorf("no firing alert with ID %s", ack.AlertID)
+}
+
+// firing returns a copy of the firing alerts.
+func (s *alertState) firing() []alerts.Alert {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	var firing []alerts.Alert
+	for _, alert := range s.active {
+		firing = append(firing, *alert)
+	}
+	return firing
+}
+
+// snapshot drops the silences that have ended and returns a copy of the state.
+func (s *alertState) snapshot(now time.Time) alerts.State {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	var silences []alerts.Silence
+	for _, silence := range s.silences {
+		if now.Before(silence.EndsAt) {
+			silences = append(silences, silence)
+		}
+	}
+	s.silences = silences
+
+	active := make([]alerts.Alert, 0, len(s.active))
+	for _, alert := range s.active {
+		active = append(active, *alert)
+	}
+	sort.Slice(active, func(i, j int) bool {
+		return active[i].StartsAt.Before(active[j].StartsAt)
+	})
+
+	history := make([]alerts.Alert, len(s.history))
+	for i, alert := range s.history {
+		history[i] = *alert
+	}
+
+	incidents := make([]alerts.Incident, len(s.incidents))
+	for i, entry := range s.incidents {
+		incidents[i] = entry.incident
+		incidents[i].Timeline = append([]alerts.IncidentEvent{}, entry.incident.Timeline...)
+	}
+
+	return alerts.State{
+		Silences:  append([]alerts.Silence{}, s.silences...),
+		Active:    active,
+		History:   history,
+		Incidents: incidents,
+	}
+}
+
+// restore replaces the state by the state published by the leader, so that a follower
+// keeps the same alerts, acknowledgements and incidents when it takes over. The
+// alerts and incidents are considered notified by the leader.
+func (s *alertState) restore(snapshot alerts.State, now time.Time) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.silences = append([]alerts.Silence{}, snapshot.Silences...)
+	s.active = make(map[string]*alerts.Alert)
+	s.notified = make(map[string]time.Time)
+	activeByID := make(map[string]*alerts.Alert)
+	for i := range snapshot.Active {
+		alert := snapshot.Active[i]
+		s.active[alert.Key()] = &alert
+		s.notified[alert.Key()] = now
+		activeByID[alert.ID] = &alert
+	}
+
+	// The firing alerts of the history are the active ones, so both are updated together
+	s.history = make([]*alerts.Alert, len(snapshot.History))
+	for i := range snapshot.History {
+		alert := snapshot.History[i]
+		s.history[i] = &alert
+		if active, ok := activeByID[alert.ID]; ok {
+			s.history[i] = active
+		}
+	}
+
+	s.incidents = make([]*incidentEntry, len(snapshot.Incidents))
+	s.latestIncidents = make(map[string]*incidentEntry)
+	for i, incident := range snapshot.Incidents {
+		entry := &incidentEntry{incident: incident, firing: make(map[string]bool), lastActivity: incident.StartsAt, notified: now}
+		if len(incident.Timeline) > 0 {
+			entry.lastActivity = incident.Timeline[len(incident.Timeline)-1].Time
+		}
+		for _, alert := range s.active {
+			if alert.IncidentID == incident.ID {
+				entry.firing[alert.ID] = true
+			}
+		}
+		s.incidents[i] = entry
+		s.latestIncidents[incident.Airport] = entry
+	}
+}
+
+func (m *alertManager) onStateReceived(_ mqtt.Client, message mqtt.Message) {
+	if m.election.isLeader() {
+		return
+	}
+
+	var snapshot alerts.State
+	err := json.Unmarshal(message.Payload(), &snapshot)
+	if err != nil {
+		log.Println("Error decoding leader state:", err)
+		return
+	}
+	m.state.restore(snapshot, time.Now())
+}
+
+// Minimum delay between two publications of the state.
+const statePublishInterval = time.Second
+
+// publishState asks for the state to be published, successive changes are coalesced
+// so the state is encoded at most once per statePublishInterval.
+func (m *alertManager) publishState() {
+	select {
+	case m.statePending <- struct{}{}:
+	default:
+	}
+}
+
+func (m *alertManager) runStatePublisher() {
+	for range m.statePending {
+		state := m.state.snapshot(time.Now())
+		state.PublishFailures = publishFailures.Load()
+		payload, err := json.Marshal(state)
+		if err != nil {
+			log.Println("Error encoding alert state:", err)
+			continue
+		}
+
+		m.publisher.PublishAsync(STATE_TOPIC, 1, true, payload, onPublishError(STATE_TOPIC))
+		time.Sleep(statePublishInterval)
+	}
+}
+
+func (m *alertManager) onSilenceCommand(_ mqtt.Client, message mqtt.Message) {
+	var silence alerts.Silence
+	err := json.Unmarshal(message.Payload(), &silence)
+	if err != nil {
+		log.Println("Error decoding silence command:", err)
+		return
+	}
+
+	if silence.ID == "" {
+		silence.ID = alerts.NewID()
+	}
+	err = silence.Validate()
+	if err != nil {
+		log.Println("Invalid silence:", err)
+		return
+	}
+
+	m.state.addSilence(silence)
+	log.Printf("Silence %s added until %s\n", silence.ID, silence.EndsAt.Format(time.RFC3339))
+	m.publishState()
+}
+
+func (m *alertManager) onAckCommand(_ mqtt.Client, message mqtt.Message) {
+	var ack alerts.Acknowledgement
+	err := json.Unmarshal(message.Payload(), &ack)
+	if err != nil {
+		log.Println("Error decoding acknowledgement command:", err)
+		return
+	}
+
+	err = ack.Validate()
+	if err != nil {
+		log.Println("Invalid acknowledgement:", err)
+		return
+	}
+	if ack.At.IsZero() {
+		ack.At = time.Now()
+	}
+
+	err = m.state.acknowledge(ack)
+	if err != nil {
+		log.Println("Error acknowledging alert:", err)
+		return
+	}
+
+	log.Printf("Alert %s acknowledged by %s\n", ack.AlertID, ack.By)
+	m.publishState()
+}
@@ -0,0 +1,121 @@
+package main
+
+import (
+	"ArchiD-Projet/internal/alerts"
+	"ArchiD-Projet/internal/sensors"
+	"fmt"
+	"log"
+	"time"
+)
+
+type WatchdogConfig struct {
+	Interval      time.Duration            `yaml:"interval"`
+	MaxAge        time.Duration            `yaml:"maxAge"`
+	Measurements  map[string]time.Duration `yaml:"measurements"`
+	Severity      string                   `yaml:"severity"`
+	SensorConfigs []string                 `yaml:"sensorConfigs"`
+}
+
+// seriesActivity tracks when a series last received a message and the time of its
+// latest observation, since sensors keep republishing the last Météo-France value.
+type seriesActivity struct {
+	airport     string
+	measurement string
+	received    time.Time
+	observed    time.Time
+}
+
+func (m *alertManager) expectSeries(airport string, measurement string, now time.Time) {
+	m.activityMutex.Lock()
+	defer m.activityMutex.Unlock()
+
+	key := seriesKey(airport, measurement)
+	if _, ok := m.activity[key]; !ok {
+		m.activity[key] = &seriesActivity{airport: airport, measurement: measurement, received: now, observed: now}
+	}
+}
+
+func (m *alertManager) recordActivity(reading alerts.Alert, now time.Time) {
+	m.activityMutex.Lock()
+	defer m.activityMutex.Unlock()
+
+	key := seriesKey(reading.Airport, reading.Measurement)
+	series, ok := m.activity[key]
+	if !ok {
+		series = &seriesActivity{airport: reading.Airport, measurement: reading.Measurement}
+		m.activity[key] = series
+	}
+	series.received = now
+	if reading.Time.After(series.observed) {
+		series.observed = reading.Time
+	}
+}
+
+func (m *alertManager) loadExpectedSeries(config WatchdogConfig, now time.Time) error {
+	for _, filename := range config.SensorConfigs {
+		sensorsConfig, err := sensors.LoadSensorConfigs(filename)
+		if err != nil {
+			return fmt.Errorf("error loading %s: %v", filename, err)
+		}
+		for _, sensor := range sensorsConfig.Sensors {
+			m.expectSeries(sensor.AirportIATA, sensor.Measurement(), now)
+		}
+	}
+	return nil
+}
+
+// checkStaleSeries returns the watchdog alert of every known series, firing when
+// the series has no fresh data for longer than its maximum age.
+func (m *alertManager) checkStaleSeries(config WatchdogConfig, now time.Time) []ruleResult {
+	m.activityMutex.Lock()
+	defer m.activityMutex.Unlock()
+
+	var results []ruleResult
+	for _, series := range m.activity {
+		maxAge, ok := config.Measurements[series.measurement]
+		if !ok {
+			maxAge = config.MaxAge
+		}
+
+		age := now.Sub(series.received)
+		if observedAge := now.Sub(series.observed); observedAge > age {
+			age = observedAge
+		}
+
+		alert := alerts.Alert{
+			Airport:     series.airport,
+			Measurement: series.measurement,
+			Rule:        "no_data",
+			Severity:    config.Severity,
+			Message:     fmt.Sprintf("Alert: No %s data for %s since %s", series.measurement, series.airport, age.Round(time.Minute)),
+			Time:        now,
+		}
+		results = append(results, ruleResult{alert: alert, firing: age > maxAge})
+	}
+	return results
+}
+
+func (m *alertManager) runWatchdog(config WatchdogConfig) {
+	ticker := time.NewTicker(config.Interval)
+	defer ticker.Stop()
+
+	for now := range ticker.C {
+		for _, result := range m.checkStaleSeries(config, now) {
+			m.updateAlert(result.alert, result.firing)
+		}
+	}
+}
+
+func (m *alertManager) startWatchdog(config WatchdogConfig) {
+	if config.Interval == 0 || config.MaxAge == 0 {
+		log.Println("Watchdog disabled: interval and maxAge must be set")
+		return
+	}
+
+	err := m.loadExpectedSeries(config, time.Now())
+	if err != nil {
+		log.Println("Error loading expected series:", err)
+	}
+
+	go m.runWatchdog(config)
+}
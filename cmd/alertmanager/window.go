@@ -0,0 +1,199 @@
+package main
+
+import (
+	"ArchiD-Projet/internal/alerts"
+	"fmt"
+	"github.com/Knetic/govaluate"
+	"sync"
+	"time"
+)
+
+type RateOfChangeRule struct {
+	Name        string        `yaml:"name"`
+	Measurement string        `yaml:"measurement"`
+	Direction   string        `yaml:"direction"`
+	Change      float64       `yaml:"change"`
+	Window      time.Duration `yaml:"window"`
+	Severity    string        `yaml:"severity"`
+}
+
+type sample struct {
+	time  time.Time
+	value float64
+}
+
+// seriesWindow keeps the recent samples of one airport/measurement series, oldest first.
+type seriesWindow struct {
+	samples []sample
+}
+
+// Every series is kept at least this long so composite rules can look at trends.
+const minimumRetention = 6 * time.Hour
+
+// airportWindows holds the series of one airport. Its mutex is held while the rules of
+// a reading are evaluated, readings of different airports are evaluated in parallel.
+type airportWindows struct {
+	mutex  sync.Mutex
+	series map[string]*seriesWindow
+	// Composite expressions are parsed once per airport and evaluated at time now
+	expressions map[string]*govaluate.EvaluableExpression
+	now         time.Time
+}
+
+func (m *alertManager) getAirportWindows(airport string) *airportWindows {
+	m.windowsMutex.RLock()
+	airportSeries, ok := m.windows[airport]
+	m.windowsMutex.RUnlock()
+	if ok {
+		return airportSeries
+	}
+
+	m.windowsMutex.Lock()
+	defer m.windowsMutex.Unlock()
+	airportSeries, ok = m.windows[airport]
+	if !ok {
+		airportSeries = &airportWindows{
+			series:      make(map[string]*seriesWindow),
+			expressions: make(map[string]*govaluate.EvaluableExpression),
+		}
+		m.windows[airport] = airportSeries
+	}
+	return airportSeries
+}
+
+func seriesKey(airport string, measurement string) string {
+	return airport + "/" + measurement
+}
+
+func (window *seriesWindow) latest() sample {
+	return window.samples[len(window.samples)-1]
+}
+
+func (window *seriesWindow) add(s sample, retention time.Duration) {
+	last := len(window.samples) - 1
+	switch {
+	case last >= 0 && s.time.Equal(window.samples[last].time):
+		// Sensors republish the latest observation until Météo-France updates it
+		window.samples[last] = s
+	case last >= 0 && s.time.Before(window.samples[last].time):
+		return
+	default:
+		window.samples = append(window.samples, s)
+	}
+
+	cutoff := s.time.Add(-retention)
+	first := 0
+	for first < len(window.samples) && window.samples[first].time.Before(cutoff) {
+		first++
+	}
+	window.samples = window.samples[first:]
+}
+
+// oldest returns the first sample observed since the given time.
+func (window *seriesWindow) oldest(since time.Time) sample {
+	for _, s := range window.samples {
+		if !s.time.Before(since) {
+			return s
+		}
+	}
+	return window.latest()
+}
+
+// extremes returns the lowest and highest values observed since the given time.
+func (window *seriesWindow) extremes(since time.Time) (float64, float64) {
+	low, high := window.latest().value, window.latest().value
+	for _, s := range window.samples {
+		if s.time.Before(since) {
+			continue
+		}
+		if s.value < low {
+			low = s.value
+		}
+		if s.value > high {
+			high = s.value
+		}
+	}
+	return low, high
+}
+
+// recordSample adds a reading to its series window and returns the window.
+// The caller must hold the airport mutex.
+func (airportSeries *airportWindows) recordSample(reading alerts.Alert, rules []RateOfChangeRule) *seriesWindow {
+	retention := minimumRetention
+	for _, rule := range rules {
+		if rule.Measurement == reading.Measurement && rule.Window > retention {
+			retention = rule.Window
+		}
+	}
+
+	window, ok := airportSeries.series[reading.Measurement]
+	if !ok {
+		window = &seriesWindow{}
+		airportSeries.series[reading.Measurement] = window
+	}
+	window.add(sample{time: reading.Time, value: reading.Value}, retention)
+
+	return window
+}
+
+// ruleResult is the outcome of evaluating a rule on a reading.
+type ruleResult struct {
+	alert  alerts.Alert
+	firing bool
+}
+
+// checkRateOfChange evaluates the rate-of-change rules against a series window.
+// The caller must hold the airport mutex.
+func checkRateOfChange(window *seriesWindow, reading alerts.Alert, rules []RateOfChangeRule) []ruleResult {
+	var results []ruleResult
+	for _, rule := range rules {
+		if rule.Measurement != reading.Measurement {
+			continue
+		}
+
+		low, high := window.extremes(reading.Time.Add(-rule.Window))
+
+		var change float64
+		switch rule.Direction {
+		case "fall":
+			change = high - reading.Value
+		case "rise":
+			change = reading.Value - low
+		default:
+			continue
+		}
+
+		alert := reading
+		alert.Rule = rule.Name
+		alert.Severity = rule.Severity
+		alert.Message = fmt.Sprintf("Alert: %s %s %f in %s (threshold %f)", reading.Measurement, directionVerb(rule.Direction), change, rule.Window, rule.Change)
+		results = append(results, ruleResult{alert: alert, firing: change > rule.Change})
+	}
+	return results
+}
+
+func (m *alertManager) checkSeriesRules(reading alerts.Alert, thresholds Thresholds) {
+	airportSeries := m.getAirportWindows(reading.Airport)
+	airportSeries.mutex.Lock()
+	window := airportSeries.recordSample(reading, thresholds.RateOfChange)
+	results := checkRateOfChange(window, reading, thresholds.RateOfChange)
+	results = append(results, airportSeries.checkComposite(reading, thresholds.Composite)...)
+	components, runwayResults := airportSeries.checkRunways(reading, m.airportInfo.Airports[reading.Airport])
+	results = append(results, runwayResults...)
+	airportSeries.mutex.Unlock()
+
+	m.publishRunwayWinds(components)
+
+	results = append(results, m.checkAnomaly(reading, thresholds.Anomaly)...)
+
+	for _, result := range results {
+		m.updateAlert(result.alert, result.firing)
+	}
+}
+
+func directionVerb(direction string) string {
+	if direction == "fall" {
+		return "fell"
+	}
+	return "rose"
+}
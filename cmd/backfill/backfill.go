@@ -0,0 +1,162 @@
+package main
+
+import (
+	brokerconfiguration "ArchiD-Projet/internal/brokerConfiguration"
+	"ArchiD-Projet/internal/influxstore"
+	"ArchiD-Projet/internal/recordings"
+	"flag"
+	"fmt"
+	"github.com/joho/godotenv"
+	"log"
+	"strings"
+	"time"
+)
+
+type BackfillResult struct {
+	Files    int
+	Read     int
+	Existing int
+	Written  int
+}
+
+// backfill writes the records of the files in [from, to) that InfluxDB does not have yet,
+// batchSize points at a time. The existing points are queried once per airport and day.
+func backfill(store influxstore.Store, files []recordings.File, from time.Time, to time.Time, batchSize int, dryRun bool) (BackfillResult, error) {
+	var result BackfillResult
+	var batch []influxstore.Point
+	flush := func() error {
+		if len(batch) == 0 || dryRun {
+			batch = nil
+			return nil
+		}
+		err := store.Write(batch)
+		batch = nil
+		return err
+	}
+
+	var existing map[influxstore.Key]bool
+	var existingAirport string
+	var existingDay time.Time
+	for i, file := range files {
+		if existing == nil || file.Airport != existingAirport || !file.Day.Equal(existingDay) {
+			points, err := store.Query(file.Day, file.Day.AddDate(0, 0, 1), []string{file.Airport}, nil)
+			if err != nil {
+				return result, fmt.Errorf("error querying %s on %s: %w", file.Airport, file.Day.Format("2006-01-02"), err)
+			}
+			existing = make(map[influxstore.Key]bool)
+			for _, point := range points {
+				existing[point.Key()] = true
+			}
+			existingAirport, existingDay = file.Airport, file.Day
+		}
+
+		records, err := recordings.ReadFile(file.Path, file.Airport)
+		if err != nil {
+			return result, fmt.Errorf("error reading %s: %w", file.Path, err)
+		}
+
+		var read, skipped, written int
+		for _, record := range records {
+			if record.Time.Before(from) || !record.Time.Before(to) {
+				continue
+			}
+			read++
+
+			// Points already in InfluxDB, or met earlier in the files, are not written again
+			point := influxstore.Point{Airport: record.Airport, Measurement: record.Measurement, Time: record.Time, Value: record.Value}
+			if existing[point.Key()] {
+				skipped++
+				continue
+			}
+			existing[point.Key()] = true
+
+			if point.Airport == "" {
+				point.Airport = file.Airport
+			}
+			batch = append(batch, point)
+			written++
+			if len(batch) >= batchSize {
+				err := flush()
+				if err != nil {
+					return result, fmt.Errorf("error writing points: %w", err)
+				}
+			}
+		}
+
+		result.Files++
+		result.Read += read
+		result.Existing += skipped
+		result.Written += written
+		log.Printf("[%d/%d] %s: %d readings, %d already in InfluxDB, %d written\n", i+1, len(files), file.Path, read, skipped, written)
+	}
+
+	err := flush()
+	if err != nil {
+		return result, fmt.Errorf("error writing points: %w", err)
+	}
+	return result, nil
+}
+
+func main() {
+	recorderConfig := brokerconfiguration.GetFileRecorderConfig()
+	dir := flag.String("dir", recorderConfig.RecordingPath, "Directory of the filerecorder recordings")
+	pathTemplate := flag.String("pathTemplate", recorderConfig.PathTemplate, "Path template of the recordings in the directory")
+	hive := flag.Bool("hive", recorderConfig.HivePartitions, "The recordings use Hive partition directories")
+	airportList := flag.String("airports", "", "Comma separated airports to import, all by default")
+	from := flag.String("from", "", "First day to import (yyyy-mm-dd)")
+	to := flag.String("to", "", "Last day to import, excluded (yyyy-mm-dd)")
+	batchSize := flag.Int("batch", 5000, "Number of points written to InfluxDB at once")
+	dryRun := flag.Bool("dryRun", false, "Report the points to import without writing them")
+	flag.Parse()
+
+	start, err := time.ParseInLocation("2006-01-02", *from, recordings.SensorZone)
+	if err != nil {
+		log.Fatal("Invalid start date:", err)
+		return
+	}
+	end, err := time.ParseInLocation("2006-01-02", *to, recordings.SensorZone)
+	if err != nil {
+		log.Fatal("Invalid end date:", err)
+		return
+	}
+	if *batchSize <= 0 {
+		log.Fatal("The batch size must be positive")
+		return
+	}
+	var airportCodes []string
+	if *airportList != "" {
+		airportCodes = strings.Split(*airportList, ",")
+	}
+
+	layout, err := recordings.NewLayout(*pathTemplate, *hive, "")
+	if err != nil {
+		log.Fatal("Invalid recording path template:", err)
+		return
+	}
+	files, err := recordings.Find(*dir, layout, start, end, airportCodes)
+	if err != nil {
+		log.Fatal("Error listing the recordings:", err)
+		return
+	}
+	if len(files) == 0 {
+		log.Fatal("No recordings found for the specified parameters")
+		return
+	}
+
+	err = godotenv.Load()
+	if err != nil {
+		log.Println("No .env file loaded:", err)
+	}
+	client, err := influxstore.NewClient()
+	if err != nil {
+		log.Fatal("Error connecting to InfluxDB:", err)
+		return
+	}
+	defer client.Close()
+
+	result, err := backfill(client, files, start, end, *batchSize, *dryRun)
+	log.Printf("%d files, %d readings, %d already in InfluxDB, %d written\n", result.Files, result.Read, result.Existing, result.Written)
+	if err != nil {
+		log.Fatal("Backfill failed:", err)
+	}
+}
@@ -0,0 +1,51 @@
+package main
+
+import (
+	"ArchiD-Projet/internal/influxstore"
+	"ArchiD-Projet/internal/recordings"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestBackfillSkipsExistingPoints(t *testing.T) {
+	dir := t.TempDir()
+	day := time.Date(2024, 1, 19, 0, 0, 0, 0, recordings.SensorZone)
+
+	// A legacy file and a rotated CSV part of the same day
+	os.WriteFile(filepath.Join(dir, "MRS_2024-01-19.csv"), []byte("2024-01-19 10:00:00 wind 8.000000\n2024-01-19 10:01:00 wind 9.000000\n2024-01-19 10:02:00 wind 10.000000\n"), 0644)
+	part := recordings.Header(recordings.FormatCSV)
+	for _, minute := range []int{2, 3} {
+		part = append(part, recordings.Format(recordings.FormatCSV, recordings.Record{Airport: "MRS", Time: day.Add(10*time.Hour + time.Duration(minute)*time.Minute), Measurement: "wind", Value: 10})...)
+	}
+	os.WriteFile(filepath.Join(dir, "MRS_2024-01-19.1.csv"), part, 0644)
+	os.WriteFile(filepath.Join(dir, "LYS_2024-01-19.csv"), []byte("2024-01-19 10:00:00 wind 3.000000\n"), 0644)
+
+	layout, _ := recordings.NewLayout("", false, "")
+	files, err := recordings.Find(dir, layout, day, day.AddDate(0, 0, 1), []string{"MRS"})
+	if err != nil || len(files) != 2 {
+		t.Fatalf("expected the 2 files of MRS, got %v (%v)", files, err)
+	}
+
+	store := &influxstore.Memory{Points: []influxstore.Point{
+		{Airport: "MRS", Measurement: "wind", Time: day.Add(10 * time.Hour), Value: 8},
+		{Airport: "LYS", Measurement: "wind", Time: day.Add(10*time.Hour + 3*time.Minute), Value: 3},
+	}}
+	result, err := backfill(store, files, day, day.AddDate(0, 0, 1), 2, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// 10:00 is in InfluxDB and 10:02 is in both files
+	if result.Read != 5 || result.Existing != 2 || result.Written != 3 {
+		t.Errorf("unexpected result %+v", result)
+	}
+	if len(store.Batches) != 2 || len(store.Batches[0]) != 2 || len(store.Batches[1]) != 1 {
+		t.Fatalf("expected batches of 2 and 1 points, got %d batches", len(store.Batches))
+	}
+	point := store.Batches[0][0]
+	if point.Airport != "MRS" || point.Measurement != "wind" || point.Value != 10 || !point.Time.Equal(day.Add(10*time.Hour+2*time.Minute)) {
+		t.Errorf("unexpected point %+v", point)
+	}
+}
@@ -0,0 +1,95 @@
+package main
+
+import (
+	"ArchiD-Projet/internal/recordings"
+	"bytes"
+	"encoding/csv"
+	"fmt"
+	mqtt "github.com/eclipse/paho.mqtt.golang"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+var alertHeader = []string{"airport", "timestamp", "message"}
+
+// The alert logs are named like the flat CSV recordings.
+var alertLayout, _ = recordings.NewLayout(recordings.DefaultPathTemplate, false, recordings.FormatCSV)
+
+// Topics of the alert manager matched by the alert subscription that are not alerts.
+var ignoredAlertTopics = make(map[string]bool)
+
+// Alerts are rare, every line is synced to disk before the next one so that the audit
+// trail does not depend on a clean shutdown.
+var alertMutex sync.Mutex
+
+func alertLine(fields []string) []byte {
+	var buffer bytes.Buffer
+	writer := csv.NewWriter(&buffer)
+	writer.Write(fields)
+	writer.Flush()
+	return buffer.Bytes()
+}
+
+// writeAlert appends an alert to the daily alert log of its airport, named like the flat
+// recordings, "MRS_2024-01-19.csv".
+func writeAlert(dir string, airport string, received time.Time, message string) error {
+	alertMutex.Lock()
+	defer alertMutex.Unlock()
+
+	received = received.In(recordings.SensorZone)
+	path := filepath.Join(dir, fmt.Sprintf("%s_%s.csv", airport, received.Format("2006-01-02")))
+	err := os.MkdirAll(dir, 0755)
+	if err != nil {
+		return err
+	}
+
+	file, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	var line []byte
+	info, err := file.Stat()
+	if err == nil && info.Size() == 0 {
+		line = alertLine(alertHeader)
+	}
+	line = append(line, alertLine([]string{airport, received.Format(time.RFC3339), message})...)
+
+	_, err = file.Write(line)
+	if err != nil {
+		return err
+	}
+	return file.Sync()
+}
+
+// compressAlertLog compresses the alert log of an ended day, holding the lock so that no
+// alert is appended while it is replaced.
+func compressAlertLog(path string, method string) (string, error) {
+	alertMutex.Lock()
+	defer alertMutex.Unlock()
+
+	compressed, err := recordings.CompressFile(path, method)
+	if err != nil {
+		return "", err
+	}
+	writeChecksum(compressed)
+	return compressed, nil
+}
+
+func onAlertReceived(_ mqtt.Client, message mqtt.Message) {
+	if ignoredAlertTopics[message.Topic()] {
+		return
+	}
+
+	// Alert topics end with the airport, airports/alertManager/<IATA>
+	airport := message.Topic()[strings.LastIndex(message.Topic(), "/")+1:]
+	err := writeAlert(options.AlertPath, airport, time.Now(), string(message.Payload()))
+	if err != nil {
+		log.Println("Failed to write alert:", err)
+	}
+}
@@ -0,0 +1,270 @@
+package main
+
+import (
+	"ArchiD-Projet/internal/recordings"
+	"encoding/json"
+	"errors"
+	"log"
+	"os"
+	"path/filepath"
+	"sync"
+	"syscall"
+	"time"
+)
+
+const (
+	HealthOK = "ok"
+	// HealthDegraded means that the recording directory is unwritable and the records are
+	// spooled to the fallback directory
+	HealthDegraded = "degraded"
+	// HealthFailing means that the records are dropped
+	HealthFailing = "failing"
+)
+
+// Health is published on the health topic when it changes and every minute.
+type Health struct {
+	Status string    `json:"status"`
+	Since  time.Time `json:"since"`
+	Error  string    `json:"error,omitempty"`
+	// Records written to the recording directory, to the fallback directory, and lost
+	Written  int64 `json:"written"`
+	Spooled  int64 `json:"spooled"`
+	Dropped  int64 `json:"dropped"`
+	DiskFull int64 `json:"diskFull"`
+}
+
+// resilientRecorder writes the records to the recording directory. After a failure the
+// directory is retried with an exponential backoff and the records are spooled to the
+// fallback directory in the meantime, or dropped when there is none or it fails too.
+// The spool is written back once the recording directory works again.
+type resilientRecorder struct {
+	mutex       sync.Mutex
+	primary     *writerManager
+	fallback    *writerManager
+	dir         string
+	fallbackDir string
+	layout      *recordings.Layout
+	format      string
+	minBackoff  time.Duration
+	maxBackoff  time.Duration
+	backoff     time.Duration
+	retryAt     time.Time
+	health      Health
+	// Called with the health when its status changes
+	onHealthChange func(Health)
+}
+
+func newResilientRecorder(primary *writerManager, fallback *writerManager, dir string, fallbackDir string, layout *recordings.Layout, format string, minBackoff time.Duration, maxBackoff time.Duration) *resilientRecorder {
+	if minBackoff == 0 {
+		minBackoff = time.Second
+	}
+	if maxBackoff < minBackoff {
+		maxBackoff = minBackoff
+	}
+	return &resilientRecorder{
+		primary:     primary,
+		fallback:    fallback,
+		dir:         dir,
+		fallbackDir: fallbackDir,
+		layout:      layout,
+		format:      format,
+		minBackoff:  minBackoff,
+		maxBackoff:  maxBackoff,
+		health:      Health{Status: HealthOK, Since: time.Now()},
+	}
+}
+
+func isDiskFull(err error) bool {
+	return errors.Is(err, syscall.ENOSPC)
+}
+
+func (r *resilientRecorder) record(record recordings.Record, now time.Time) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	day := record.Time.In(recordings.SensorZone).Format("2006-01-02")
+	path := r.layout.Path(record, r.format)
+
+	var err error
+	if !now.Before(r.retryAt) {
+		err = r.primary.write(filepath.Join(r.dir, path), day, record)
+		if err == nil {
+			r.health.Written++
+			if r.health.Status != HealthOK {
+				r.backoff = 0
+				r.setStatus(HealthOK, nil, now)
+				go r.drain()
+			}
+			return
+		}
+
+		r.backoff = min(max(2*r.backoff, r.minBackoff), r.maxBackoff)
+		r.retryAt = now.Add(r.backoff)
+		log.Printf("Failed to write to %s, retrying in %s: %v\n", r.dir, r.backoff, err)
+	}
+
+	if r.fallback != nil {
+		fallbackErr := r.fallback.write(filepath.Join(r.fallbackDir, path), day, record)
+		if fallbackErr == nil {
+			r.health.Spooled++
+			r.setStatus(HealthDegraded, err, now)
+			return
+		}
+		err = fallbackErr
+	}
+
+	r.health.Dropped++
+	if isDiskFull(err) {
+		r.health.DiskFull++
+	}
+	r.setStatus(HealthFailing, err, now)
+}
+
+// setStatus sets the status of the health, and its error unless err is nil while the
+// recording directory is not retried.
+func (r *resilientRecorder) setStatus(status string, err error, now time.Time) {
+	if err != nil || status == HealthOK {
+		r.health.Error = ""
+		if err != nil {
+			r.health.Error = err.Error()
+		}
+	}
+	if status == r.health.Status {
+		return
+	}
+
+	r.health.Status = status
+	r.health.Since = now
+	log.Printf("Recorder health %s %s\n", status, r.health.Error)
+	if r.onHealthChange != nil {
+		r.onHealthChange(r.currentHealth())
+	}
+}
+
+// currentHealth adds the buffered records lost by the writers to the dropped ones.
+func (r *resilientRecorder) currentHealth() Health {
+	health := r.health
+	health.Dropped += r.primary.lostRecords()
+	if r.fallback != nil {
+		health.Dropped += r.fallback.lostRecords()
+	}
+	return health
+}
+
+func (r *resilientRecorder) getHealth() Health {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	return r.currentHealth()
+}
+
+// drain writes the records spooled to the fallback directory to the recording directory
+// and removes the spooled files. It stops at the first failure, the remaining records are
+// drained the next time the recording directory works again. The records are not handled
+// meanwhile so that none is spooled to a file being drained.
+func (r *resilientRecorder) drain() {
+	if r.fallback == nil {
+		return
+	}
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	r.fallback.closeFiles()
+	files, err := recordings.Find(r.fallbackDir, r.layout, time.Time{}, time.Now().AddDate(0, 0, 2), nil)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			log.Println("Failed to list the spooled recordings:", err)
+		}
+		return
+	}
+
+	for _, file := range files {
+		records, err := recordings.ReadFile(file.Path, file.Airport)
+		if err != nil {
+			log.Printf("Failed to read the spooled recording %s: %v\n", file.Path, err)
+			continue
+		}
+
+		written, err := r.writeBack(records)
+		if err != nil {
+			log.Printf("Failed to write back %s after %d of %d records: %v\n", file.Path, written, len(records), err)
+			if written > 0 {
+				err = rewriteSpool(file.Path, r.format, records[written:])
+				if err != nil {
+					log.Printf("Failed to keep the remaining records of %s: %v\n", file.Path, err)
+				}
+			}
+			return
+		}
+
+		os.Remove(file.Path + recordings.ChecksumExtension)
+		err = os.Remove(file.Path)
+		if err != nil {
+			log.Printf("Failed to remove the spooled recording %s: %v\n", file.Path, err)
+			return
+		}
+		log.Printf("Wrote back %d spooled records of %s\n", len(records), file.Path)
+	}
+}
+
+// writeBack writes records to the recording directory, syncing them every flushEvery
+// records, and returns the number of records synced. Only the records of the chunk
+// being written when a failure happens can reach the disk and stay in the spool.
+func (r *resilientRecorder) writeBack(records []recordings.Record) (int, error) {
+	written := 0
+	for written < len(records) {
+		end := min(written+r.primary.flushEvery, len(records))
+		for _, record := range records[written:end] {
+			day := record.Time.In(recordings.SensorZone).Format("2006-01-02")
+			err := r.primary.write(filepath.Join(r.dir, r.layout.Path(record, r.format)), day, record)
+			if err != nil {
+				return written, err
+			}
+		}
+
+		err := r.primary.syncFiles(time.Now())
+		if err != nil {
+			return written, err
+		}
+		written = end
+	}
+	return written, nil
+}
+
+// rewriteSpool replaces a spooled recording with the records not written back yet.
+func rewriteSpool(path string, format string, records []recordings.Record) error {
+	temporary := path + ".tmp"
+	os.Remove(temporary)
+	writer, err := recordings.OpenWriter(temporary, format, recordings.CompressionNone)
+	if err != nil {
+		return err
+	}
+	for _, record := range records {
+		err = writer.Write(record)
+		if err != nil {
+			writer.Close()
+			return err
+		}
+	}
+	err = writer.Close()
+	if err != nil {
+		return err
+	}
+
+	os.Remove(path + recordings.ChecksumExtension)
+	return os.Rename(temporary, path)
+}
+
+// runHealth publishes the health every interval.
+func (r *resilientRecorder) runHealth(interval time.Duration, publish func(Health)) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		publish(r.getHealth())
+	}
+}
+
+func healthPayload(health Health) []byte {
+	payload, _ := json.Marshal(health)
+	return payload
+}
@@ -4,71 +4,170 @@ import (
 	brokerConfiguration "ArchiD-Projet/internal/brokerConfiguration"
 	brokerUtils "ArchiD-Projet/internal/brokerUtils"
 	"ArchiD-Projet/internal/mqttconnect"
+	"ArchiD-Projet/internal/recordings"
+	"ArchiD-Projet/internal/sensors"
+	"flag"
 	"fmt"
 	mqtt "github.com/eclipse/paho.mqtt.golang"
 	"log"
 	"os"
-	"strings"
+	"path/filepath"
 	"time"
 )
 
 var (
-	config = brokerConfiguration.GetFileRecorderSettings()
-	BROKER = brokerConfiguration.GetBrokerAddress()
-	TOPIC  = config[0]
+	BROKER  = brokerConfiguration.GetBrokerAddress()
+	options = brokerConfiguration.GetFileRecorderConfig()
+	layout  *recordings.Layout
+	writers *writerManager
+	// Routes the records to writers, or to the fallback directory when it fails
+	recorder *resilientRecorder
+	// Sensor client IDs by airport and measurement
+	sensorIDs = make(map[string]string)
 )
 
-func onMessageReceived(_ mqtt.Client, message mqtt.Message) {
-	payload := string(message.Payload())
-	data := strings.Split(payload, " ")
+func loadSensorIDs(pattern string) error {
+	files, err := filepath.Glob(pattern)
+	if err != nil {
+		return err
+	}
 
-	submittedTimestamp := data[0] + "T" + data[1] + "Z"
-	sensor := data[2]
-	value := data[3]
+	for _, filename := range files {
+		sensorsConfig, err := sensors.LoadSensorConfigs(filename)
+		if err != nil {
+			return fmt.Errorf("error loading %s: %v", filename, err)
+		}
+		for _, sensor := range sensorsConfig.Sensors {
+			sensorIDs[sensor.AirportIATA+"/"+sensor.Measurement()] = sensor.ClientID
+		}
+	}
+	return nil
+}
 
-	timestamp, err := time.Parse(time.RFC3339, submittedTimestamp)
+func onMessageReceived(_ mqtt.Client, message mqtt.Message) {
+	airport := brokerUtils.GetAirportCodeFromTopic(message.Topic())
+	record, err := recordings.ParsePayload(airport, string(message.Payload()))
 	if err != nil {
-		log.Println("Failed to parse timestamp:", err)
+		log.Println("Failed to parse reading:", err)
 		return
 	}
+	record.Unit = sensors.Units[record.Measurement]
+	record.SensorID = sensorIDs[airport+"/"+record.Measurement]
 
-	fileName := fmt.Sprintf("%s_%s.csv", brokerUtils.GetAirportCodeFromTopic(message.Topic()), timestamp.Format("2006-01-02"))
+	recorder.record(record, time.Now())
+}
 
-	if _, err := os.Stat(config[1]); os.IsNotExist(err) {
-		err := os.Mkdir(config[1], 0755)
-		if err != nil {
-			log.Fatal("Failed to create folder:", err)
+// publishHealth publishes the health of the recorder as a retained message.
+func publishHealth(client *mqttconnect.Client, topic string, health Health) {
+	client.PublishAsync(topic, 1, true, healthPayload(health), func(err error) {
+		log.Println("Failed to publish the recorder health:", err)
+	})
+}
+
+func main() {
+	instance := flag.String("instance", "", "Name of the recorder instance in fileRecorder.instances")
+	verify := flag.Bool("verify", false, "Check the recordings and the archive against their manifests and exit")
+	flag.Parse()
+
+	clientID := "file_recorder"
+	if *instance != "" {
+		var ok bool
+		options, ok = options.Instance(*instance)
+		if !ok {
+			log.Fatalf("Unknown recorder instance: %s\n", *instance)
 			return
 		}
+		clientID += "_" + *instance
 	}
 
-	file, err := os.OpenFile(config[1]+"/"+fileName, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if options.Format == "" {
+		options.Format = recordings.FormatCSV
+	}
+	if !recordings.ValidFormat(options.Format) {
+		log.Fatalf("Unknown recording format: %s\n", options.Format)
+		return
+	}
+	if !recordings.ValidCompression(options.Compression) {
+		log.Fatalf("Unknown recording compression: %s\n", options.Compression)
+		return
+	}
+	var err error
+	layout, err = recordings.NewLayout(options.PathTemplate, options.HivePartitions, options.Format)
 	if err != nil {
-		log.Fatal("Failed to open or create file:", err)
+		log.Fatal("Invalid recording path template:", err)
 		return
 	}
-	defer file.Close()
 
-	line := fmt.Sprintf("%s %s %s\n", timestamp.Format("2006-01-02 15:04:05"), sensor, value)
-	_, err = file.WriteString(line)
-	if err != nil {
-		log.Println("Failed to write to file:", err)
+	if *verify {
+		verified, failed := verifyFiles(options.RecordingPath, options.ArchivePath)
+		log.Printf("%d files verified, %d failed\n", verified, failed)
+		if failed > 0 {
+			os.Exit(1)
+		}
 		return
 	}
-}
 
-func main() {
-	client, err := mqttconnect.NewClient(BROKER, "file_recorder", onMessageReceived)
+	recoverFiles(options.RecordingPath, layout)
+	if options.AlertSubscribe != "" {
+		recoverFiles(options.AlertPath, alertLayout)
+	}
+
+	err = loadSensorIDs("config/*_sensor_config.yml")
+	if err != nil {
+		log.Println("Error loading sensor IDs:", err)
+	}
+
+	writers = newWriterManager(options)
+	go writers.run()
+	var fallback *writerManager
+	if options.FallbackPath != "" {
+		recoverFiles(options.FallbackPath, layout)
+		fallback = newWriterManager(options)
+		go fallback.run()
+	}
+	recorder = newResilientRecorder(writers, fallback, options.RecordingPath, options.FallbackPath, layout, options.Format, options.RetryBackoff, options.MaxRetryBackoff)
+	// Records spooled before a restart
+	recorder.drain()
+	go runMaintenance(options)
+
+	client, err := mqttconnect.NewClient(BROKER, clientID, onMessageReceived)
 	if err != nil {
 		log.Fatal("Error creating MQTT client:", err)
 		return
 	}
 
-	err = client.Subscribe(TOPIC, 1, nil)
+	if options.HealthTopic != "" {
+		healthTopic := options.HealthTopic + "/" + clientID
+		recorder.onHealthChange = func(health Health) {
+			publishHealth(client, healthTopic, health)
+		}
+		publishHealth(client, healthTopic, recorder.getHealth())
+		go recorder.runHealth(time.Minute, func(health Health) {
+			publishHealth(client, healthTopic, health)
+		})
+	}
+
+	err = client.Subscribe(options.Subscribe, 1, nil)
 	if err != nil {
 		log.Fatal("Failed to subscribe to topic:", err)
 		return
 	}
 
+	if options.AlertSubscribe != "" {
+		ignoredAlertTopics[brokerConfiguration.GetAlertManagerStateTopic()] = true
+		ignoredAlertTopics[brokerConfiguration.GetAlertManagerLeaderTopic()] = true
+
+		err = client.Subscribe(options.AlertSubscribe, 1, onAlertReceived)
+		if err != nil {
+			log.Fatal("Failed to subscribe to alert topic:", err)
+			return
+		}
+	}
+
 	mqttconnect.WaitForSignal()
+	client.Disconnect()
+	writers.close()
+	if fallback != nil {
+		fallback.close()
+	}
 }
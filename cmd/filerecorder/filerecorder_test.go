@@ -0,0 +1,337 @@
+package main
+
+import (
+	brokerConfiguration "ArchiD-Projet/internal/brokerConfiguration"
+	"ArchiD-Projet/internal/recordings"
+	"os"
+	"path/filepath"
+	"reflect"
+	"slices"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+)
+
+func TestWriterManagerFlushAndRollover(t *testing.T) {
+	dir := t.TempDir()
+	m := newWriterManager(brokerConfiguration.FileRecorderConfig{RecordingPath: dir, Format: recordings.FormatCSV, FlushInterval: time.Hour, FlushEvery: 2})
+	path := filepath.Join(dir, "MRS_2024-01-19.csv")
+	record := recordings.Record{Airport: "MRS", Time: time.Date(2024, 1, 19, 10, 0, 0, 0, recordings.SensorZone), Measurement: "wind", Value: 8}
+
+	err := m.write(path, "2024-01-19", record)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if data, _ := os.ReadFile(path); len(data) != 0 {
+		t.Fatalf("record written before the flush: %q", data)
+	}
+
+	err = m.write(path, "2024-01-19", record)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, _ := os.ReadFile(path)
+	if lines := strings.Count(string(data), "\n"); lines != 3 {
+		t.Fatalf("expected the header and 2 records after %d records, got %d lines", m.flushEvery, lines)
+	}
+
+	m.flush(time.Date(2024, 1, 20, 0, 5, 0, 0, recordings.SensorZone))
+	if len(m.files) != 0 {
+		t.Errorf("file of the previous day still open")
+	}
+
+	m.write(path, "2024-01-19", record)
+	go m.run()
+	m.close()
+	data, _ = os.ReadFile(path)
+	if lines := strings.Count(string(data), "\n"); lines != 4 || strings.Count(string(data), "airport,") != 1 {
+		t.Errorf("unexpected file after reopening and shutdown:\n%s", data)
+	}
+}
+
+func TestRotationCompressionAndRetention(t *testing.T) {
+	dir := t.TempDir()
+	archive := t.TempDir()
+	options := brokerConfiguration.FileRecorderConfig{
+		RecordingPath: dir,
+		Format:        recordings.FormatCSV,
+		FlushInterval: time.Hour,
+		FlushEvery:    1,
+		Compression:   recordings.CompressionGzip,
+		RotateSize:    200,
+		Retention:     30 * 24 * time.Hour,
+		ArchivePath:   archive,
+	}
+	writers = newWriterManager(options)
+	layout, _ = recordings.NewLayout(recordings.DefaultPathTemplate, false, recordings.FormatCSV)
+
+	path := filepath.Join(dir, "MRS_2024-01-19.csv")
+	record := recordings.Record{Airport: "MRS", Time: time.Date(2024, 1, 19, 10, 0, 0, 0, recordings.SensorZone), Measurement: "wind", Value: 8}
+	for i := 0; i < 5; i++ {
+		err := writers.write(path, "2024-01-19", record)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := os.Stat(recordings.PartPath(path, 1)); err != nil {
+		t.Fatalf("file not rotated above %d bytes: %v", options.RotateSize, err)
+	}
+
+	old := filepath.Join(dir, "MRS_2023-11-02.csv")
+	os.WriteFile(old, []byte("2023-11-02 10:00:00 wind 8.000000\n"), 0644)
+
+	// The open file of the day is left alone, the rotated part is compressed
+	maintain(options, time.Date(2024, 1, 20, 2, 0, 0, 0, recordings.SensorZone))
+	if _, err := os.Stat(path); err != nil {
+		t.Errorf("open file compressed: %v", err)
+	}
+	if err := recordings.VerifyChecksum(recordings.PartPath(path, 1) + ".gz"); err != nil {
+		t.Errorf("rotated part not compressed with its manifest: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(archive, "MRS_2023-11-02.csv")); err != nil {
+		t.Errorf("expired file not archived: %v", err)
+	}
+
+	writers.flush(time.Date(2024, 1, 20, 0, 5, 0, 0, recordings.SensorZone))
+	maintain(options, time.Date(2024, 1, 20, 3, 0, 0, 0, recordings.SensorZone))
+	var records []recordings.Record
+	for _, name := range []string{path + ".gz", recordings.PartPath(path, 1) + ".gz"} {
+		fileRecords, err := recordings.ReadFile(name, "MRS")
+		if err != nil {
+			t.Fatalf("reading %s: %v", name, err)
+		}
+		records = append(records, fileRecords...)
+	}
+	if len(records) != 5 {
+		t.Errorf("expected 5 records in the compressed parts, got %d", len(records))
+	}
+}
+
+func TestParquetRowGroupsPerHour(t *testing.T) {
+	dir := t.TempDir()
+	m := newWriterManager(brokerConfiguration.FileRecorderConfig{RecordingPath: dir, Format: recordings.FormatParquet, Compression: recordings.CompressionZstd, FlushInterval: time.Hour, FlushEvery: 1})
+	path := filepath.Join(dir, "MRS_2024-01-19.parquet")
+
+	start := time.Date(2024, 1, 19, 10, 0, 0, 0, recordings.SensorZone)
+	for i := 0; i < 4; i++ {
+		record := recordings.Record{Airport: "MRS", Time: start.Add(time.Duration(i) * 20 * time.Minute), Measurement: "wind", Value: float64(i), Unit: "m/s"}
+		err := m.write(path, "2024-01-19", record)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// The hour of 10:00 is written and readable while 11:00 is still buffered
+	records, err := recordings.ReadFile(path, "MRS")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(records) != 3 {
+		t.Fatalf("expected the 3 records of the first hour, got %d", len(records))
+	}
+
+	m.flush(time.Date(2024, 1, 20, 0, 5, 0, 0, recordings.SensorZone))
+	records, err = recordings.ReadFile(path, "MRS")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(records) != 4 || records[3].Value != 3 || records[3].Unit != "m/s" || !records[3].Time.Equal(start.Add(time.Hour)) {
+		t.Errorf("unexpected records after the day rollover: %+v", records)
+	}
+
+	// The ended day loses the footer written after its first row group
+	writers = m
+	layout, _ = recordings.NewLayout(recordings.DefaultPathTemplate, false, recordings.FormatParquet)
+	before, _ := os.Stat(path)
+	maintain(brokerConfiguration.FileRecorderConfig{RecordingPath: dir}, time.Date(2024, 1, 20, 2, 0, 0, 0, recordings.SensorZone))
+	after, _ := os.Stat(path)
+	if after.Size() >= before.Size() {
+		t.Errorf("ended day not compacted: %d bytes, %d before", after.Size(), before.Size())
+	}
+	if err := recordings.VerifyChecksum(path); err != nil {
+		t.Errorf("compacted file without its manifest: %v", err)
+	}
+	compacted, err := recordings.ReadFile(path, "MRS")
+	if err != nil || !reflect.DeepEqual(compacted, records) {
+		t.Errorf("records changed by the compaction: %+v (%v)", compacted, err)
+	}
+}
+
+func TestWriteAlert(t *testing.T) {
+	dir := t.TempDir()
+	received := time.Date(2024, 1, 19, 23, 30, 0, 0, time.UTC)
+
+	for _, message := range []string{"Alert: temperature too high, 310.15", "Resolved: temperature"} {
+		err := writeAlert(dir, "MRS", received, message)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// Alerts are logged on the day of the sensors, in UTC+1
+	data, err := os.ReadFile(filepath.Join(dir, "MRS_2024-01-20.csv"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := "airport,timestamp,message\nMRS,2024-01-20T00:30:00+01:00,\"Alert: temperature too high, 310.15\"\nMRS,2024-01-20T00:30:00+01:00,Resolved: temperature\n"
+	if string(data) != expected {
+		t.Errorf("unexpected alert log:\n%s", data)
+	}
+}
+
+func TestMaintainAlertLogs(t *testing.T) {
+	dir := t.TempDir()
+	archive := t.TempDir()
+	options := brokerConfiguration.FileRecorderConfig{
+		RecordingPath:  filepath.Join(dir, "recordings"),
+		Compression:    recordings.CompressionGzip,
+		Retention:      30 * 24 * time.Hour,
+		ArchivePath:    archive,
+		AlertSubscribe: "airports/alertManager/+",
+		AlertPath:      filepath.Join(dir, "alerts"),
+	}
+	writers = newWriterManager(options)
+	layout, _ = recordings.NewLayout(recordings.DefaultPathTemplate, false, recordings.FormatCSV)
+
+	for _, day := range []time.Time{time.Date(2023, 11, 2, 10, 0, 0, 0, time.UTC), time.Date(2024, 1, 19, 10, 0, 0, 0, time.UTC), time.Date(2024, 1, 20, 0, 30, 0, 0, time.UTC)} {
+		err := writeAlert(options.AlertPath, "MRS", day, "Alert: wind")
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	maintain(options, time.Date(2024, 1, 20, 2, 0, 0, 0, recordings.SensorZone))
+	if _, err := os.Stat(filepath.Join(archive, "alerts", "MRS_2023-11-02.csv")); err != nil {
+		t.Errorf("expired alert log not archived: %v", err)
+	}
+	if err := recordings.VerifyChecksum(filepath.Join(options.AlertPath, "MRS_2024-01-19.csv.gz")); err != nil {
+		t.Errorf("ended alert log not compressed with its manifest: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(options.AlertPath, "MRS_2024-01-20.csv")); err != nil {
+		t.Errorf("alert log of the day compressed: %v", err)
+	}
+}
+
+func TestRecoverTornFile(t *testing.T) {
+	dir := t.TempDir()
+	layout, _ = recordings.NewLayout(recordings.DefaultPathTemplate, false, recordings.FormatCSV)
+	path := filepath.Join(dir, "MRS_2024-01-19.csv")
+	record := recordings.Record{Airport: "MRS", Time: time.Date(2024, 1, 19, 10, 0, 0, 0, recordings.SensorZone), Measurement: "wind", Value: 8}
+	data := append(recordings.Header(recordings.FormatCSV), recordings.Format(recordings.FormatCSV, record)...)
+	os.WriteFile(path, append(data, "MRS,2024-01-19T10:0"...), 0644)
+	os.WriteFile(filepath.Join(dir, "notes.txt"), []byte("no newline"), 0644)
+
+	if repaired := recoverFiles(dir, layout); repaired != 1 {
+		t.Fatalf("expected 1 repaired file, got %d", repaired)
+	}
+
+	m := newWriterManager(brokerConfiguration.FileRecorderConfig{RecordingPath: dir, Format: recordings.FormatCSV, FlushEvery: 1})
+	m.write(path, "2024-01-19", record)
+	m.flush(time.Date(2024, 1, 20, 0, 5, 0, 0, recordings.SensorZone))
+
+	records, err := recordings.ReadFile(path, "MRS")
+	if err != nil || len(records) != 2 {
+		t.Errorf("expected 2 records after the repair, got %d (%v)", len(records), err)
+	}
+	if err := recordings.VerifyChecksum(path); err != nil {
+		t.Errorf("no manifest at the end of the day: %v", err)
+	}
+	if data, _ := os.ReadFile(filepath.Join(dir, "notes.txt")); string(data) != "no newline" {
+		t.Errorf("file outside of the layout repaired")
+	}
+}
+
+func TestFallbackSpool(t *testing.T) {
+	root := t.TempDir()
+	blocked := filepath.Join(root, "blocked")
+	os.WriteFile(blocked, nil, 0644)
+	dir := filepath.Join(blocked, "recordings")
+	spool := filepath.Join(root, "spool")
+	options := brokerConfiguration.FileRecorderConfig{Format: recordings.FormatCSV, FlushInterval: time.Hour, FlushEvery: 1}
+	flat, _ := recordings.NewLayout("", false, recordings.FormatCSV)
+	r := newResilientRecorder(newWriterManager(options), newWriterManager(options), dir, spool, flat, recordings.FormatCSV, time.Second, time.Minute)
+
+	now := time.Date(2024, 1, 19, 10, 0, 0, 0, recordings.SensorZone)
+	record := recordings.Record{Airport: "MRS", Time: now, Measurement: "wind", Value: 8}
+	r.record(record, now)
+	r.record(record, now.Add(500*time.Millisecond))
+	health := r.getHealth()
+	if health.Status != HealthDegraded || health.Spooled != 2 || health.Written != 0 || r.backoff != time.Second {
+		t.Fatalf("unexpected health while the recording directory is unwritable: %+v", health)
+	}
+
+	// The recording directory works again after the backoff
+	os.Remove(blocked)
+	r.record(record, now.Add(2*time.Second))
+	r.drain()
+	r.primary.closeFiles()
+	records, err := recordings.ReadFile(filepath.Join(dir, "MRS_2024-01-19.csv"), "MRS")
+	if err != nil || len(records) != 3 {
+		t.Fatalf("expected the spooled records written back, got %d records: %v", len(records), err)
+	}
+	if _, err := os.Stat(filepath.Join(spool, "MRS_2024-01-19.csv")); !os.IsNotExist(err) {
+		t.Errorf("spooled recording not removed: %v", err)
+	}
+	if health := r.getHealth(); health.Status != HealthOK || health.Written != 1 {
+		t.Errorf("unexpected health after recovery: %+v", health)
+	}
+
+	// Both directories unwritable
+	blocked = filepath.Join(root, "full")
+	os.WriteFile(blocked, nil, 0644)
+	r.dir = filepath.Join(blocked, "recordings")
+	r.fallbackDir = filepath.Join(blocked, "spool")
+	r.record(record, now.Add(time.Hour))
+	if health := r.getHealth(); health.Status != HealthFailing || health.Dropped != 1 || health.DiskFull != 0 {
+		t.Errorf("unexpected health after a dropped record: %+v", health)
+	}
+	if !isDiskFull(&os.PathError{Op: "write", Path: dir, Err: syscall.ENOSPC}) {
+		t.Errorf("ENOSPC not counted as a full disk")
+	}
+}
+
+func TestDrainKeepsUnwrittenRecords(t *testing.T) {
+	dir := t.TempDir()
+	spool := t.TempDir()
+	options := brokerConfiguration.FileRecorderConfig{Format: recordings.FormatCSV, FlushInterval: time.Hour, FlushEvery: 2}
+	flat, _ := recordings.NewLayout("", false, recordings.FormatCSV)
+	r := newResilientRecorder(newWriterManager(options), newWriterManager(options), dir, spool, flat, recordings.FormatCSV, time.Second, time.Minute)
+
+	// The third record goes to a file that cannot be opened, after the first 2 are synced
+	start := time.Date(2024, 1, 19, 10, 0, 0, 0, recordings.SensorZone)
+	data := recordings.Header(recordings.FormatCSV)
+	for i, airport := range []string{"MRS", "MRS", "LYS", "MRS", "MRS"} {
+		record := recordings.Record{Airport: airport, Time: start.Add(time.Duration(i) * time.Minute), Measurement: "wind", Value: float64(i)}
+		data = append(data, recordings.Format(recordings.FormatCSV, record)...)
+	}
+	spooled := filepath.Join(spool, "MRS_2024-01-19.csv")
+	os.WriteFile(spooled, data, 0644)
+	blocked := filepath.Join(dir, "LYS_2024-01-19.csv")
+	os.MkdirAll(blocked, 0755)
+
+	r.drain()
+	records, _ := recordings.ReadFile(spooled, "MRS")
+	if len(records) != 3 || records[0].Value != 2 {
+		t.Fatalf("expected the 3 records not written back in the spool, got %+v", records)
+	}
+
+	os.Remove(blocked)
+	r.drain()
+	r.primary.closeFiles()
+	files, _ := recordings.Find(dir, flat, start, start.AddDate(0, 0, 1), nil)
+	var values []float64
+	for _, file := range files {
+		records, _ := recordings.ReadFile(file.Path, file.Airport)
+		for _, record := range records {
+			values = append(values, record.Value)
+		}
+	}
+	slices.Sort(values)
+	if !slices.Equal(values, []float64{0, 1, 2, 3, 4}) {
+		t.Errorf("expected each record written back once, got %v", values)
+	}
+	if _, err := os.Stat(spooled); !os.IsNotExist(err) {
+		t.Errorf("spooled recording not removed: %v", err)
+	}
+}
@@ -0,0 +1,151 @@
+package main
+
+import (
+	brokerConfiguration "ArchiD-Projet/internal/brokerConfiguration"
+	"ArchiD-Projet/internal/recordings"
+	"io/fs"
+	"log"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+const maintenanceInterval = time.Hour
+
+// Late readings of a day are still expected during this delay after midnight, its file
+// is only compressed or compacted afterwards.
+const dayEndGrace = time.Hour
+
+// maintain compresses the files of the ended days, compacts their Parquet files and
+// deletes or archives the files older than the retention, in the recordings and in the
+// alert logs. The alert logs are archived in a directory of the archive named after
+// AlertPath.
+func maintain(options brokerConfiguration.FileRecorderConfig, now time.Time) {
+	maintainDir(options.RecordingPath, layout, options.ArchivePath, options, now, writers.compress)
+
+	if options.AlertSubscribe != "" {
+		archivePath := ""
+		if options.ArchivePath != "" {
+			archivePath = filepath.Join(options.ArchivePath, filepath.Base(options.AlertPath))
+		}
+		maintainDir(options.AlertPath, alertLayout, archivePath, options, now, compressAlertLog)
+	}
+}
+
+// maintainDir maintains the files of a directory matching its layout. The archive and
+// the other directory of the recorder are skipped when they are inside it.
+func maintainDir(dir string, layout *recordings.Layout, archivePath string, options brokerConfiguration.FileRecorderConfig, now time.Time, compress func(string, string) (string, error)) {
+	skipped := make(map[string]bool)
+	for _, other := range []string{options.ArchivePath, options.RecordingPath, options.AlertPath} {
+		if other != "" && filepath.Clean(other) != filepath.Clean(dir) {
+			skipped[filepath.Clean(other)] = true
+		}
+	}
+
+	err := filepath.WalkDir(dir, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if entry.IsDir() {
+			if skipped[path] {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		relative, err := filepath.Rel(dir, path)
+		if err != nil {
+			return err
+		}
+		partition, ok := layout.Match(relative)
+		if !ok {
+			return nil
+		}
+		end := partition.Day.AddDate(0, 0, 1)
+
+		if options.Retention > 0 && now.Sub(end) > options.Retention {
+			expire(dir, path, archivePath)
+			return nil
+		}
+
+		if now.Sub(end) <= dayEndGrace {
+			return nil
+		}
+
+		// Parquet pages are already compressed, the file only loses its previous footers
+		if filepath.Ext(path) == recordings.Extension(recordings.FormatParquet) {
+			compacted, err := writers.compact(path)
+			if err != nil {
+				log.Printf("Failed to compact %s: %v\n", path, err)
+			} else if compacted {
+				log.Printf("Compacted %s\n", path)
+			}
+			return nil
+		}
+
+		if options.Compression != "" && options.Compression != recordings.CompressionNone && !recordings.IsCompressed(path) {
+			compressed, err := compress(path, options.Compression)
+			if err != nil {
+				log.Printf("Failed to compress %s: %v\n", path, err)
+			} else if compressed != "" {
+				log.Printf("Compressed %s to %s\n", path, compressed)
+			}
+		}
+		return nil
+	})
+	if err != nil && !os.IsNotExist(err) {
+		log.Printf("Failed to scan %s: %v\n", dir, err)
+	}
+}
+
+// expire deletes a file with its manifest and quarantined bytes, or moves them to the
+// archive directory under the same relative path, and removes the partition directories
+// it leaves empty.
+func expire(dir string, path string, archivePath string) {
+	for _, extension := range []string{"", recordings.ChecksumExtension, recordings.TornExtension} {
+		file := path + extension
+		if extension != "" {
+			if _, err := os.Stat(file); err != nil {
+				continue
+			}
+		}
+
+		if archivePath == "" {
+			err := os.Remove(file)
+			if err != nil {
+				log.Printf("Failed to delete %s: %v\n", file, err)
+				return
+			}
+			continue
+		}
+
+		relative, err := filepath.Rel(dir, file)
+		if err == nil {
+			target := filepath.Join(archivePath, relative)
+			err = os.MkdirAll(filepath.Dir(target), 0755)
+			if err == nil {
+				err = os.Rename(file, target)
+			}
+		}
+		if err != nil {
+			log.Printf("Failed to archive %s: %v\n", file, err)
+			return
+		}
+	}
+
+	// Removing a directory fails as long as it is not empty
+	parent := filepath.Dir(path)
+	for parent != filepath.Clean(dir) && os.Remove(parent) == nil {
+		parent = filepath.Dir(parent)
+	}
+}
+
+func runMaintenance(options brokerConfiguration.FileRecorderConfig) {
+	maintain(options, time.Now())
+
+	ticker := time.NewTicker(maintenanceInterval)
+	defer ticker.Stop()
+
+	for now := range ticker.C {
+		maintain(options, now)
+	}
+}
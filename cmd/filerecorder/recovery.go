@@ -0,0 +1,73 @@
+package main
+
+import (
+	"ArchiD-Projet/internal/recordings"
+	"io/fs"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// recoverFiles repairs the recordings left incomplete by a crash before they are
+// reopened. The cut bytes are kept in a quarantine file next to each repaired recording.
+func recoverFiles(dir string, layout *recordings.Layout) int {
+	repaired := 0
+	err := filepath.WalkDir(dir, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil || entry.IsDir() {
+			return err
+		}
+		relative, err := filepath.Rel(dir, path)
+		if err != nil {
+			return err
+		}
+		if _, ok := layout.Match(relative); !ok {
+			return nil
+		}
+
+		torn, err := recordings.Repair(path)
+		if err != nil {
+			log.Printf("Failed to repair %s: %v\n", path, err)
+			return nil
+		}
+		if torn > 0 {
+			log.Printf("Repaired %s, %d bytes moved to %s\n", path, torn, path+recordings.TornExtension)
+			repaired++
+		}
+		return nil
+	})
+	if err != nil && !os.IsNotExist(err) {
+		log.Println("Failed to scan the recordings:", err)
+	}
+	return repaired
+}
+
+// verifyFiles checks every file with a manifest under the directories and returns the
+// number of files verified and of files that do not match their manifest.
+func verifyFiles(dirs ...string) (int, int) {
+	verified, failed := 0, 0
+	for _, dir := range dirs {
+		if dir == "" {
+			continue
+		}
+		err := filepath.WalkDir(dir, func(path string, entry fs.DirEntry, err error) error {
+			if err != nil || entry.IsDir() || !strings.HasSuffix(path, recordings.ChecksumExtension) {
+				return err
+			}
+
+			file := strings.TrimSuffix(path, recordings.ChecksumExtension)
+			err = recordings.VerifyChecksum(file)
+			if err != nil {
+				log.Printf("FAILED %s: %v\n", file, err)
+				failed++
+				return nil
+			}
+			verified++
+			return nil
+		})
+		if err != nil && !os.IsNotExist(err) {
+			log.Printf("Failed to scan %s: %v\n", dir, err)
+		}
+	}
+	return verified, failed
+}
@@ -0,0 +1,287 @@
+package main
+
+import (
+	brokerConfiguration "ArchiD-Projet/internal/brokerConfiguration"
+	"ArchiD-Projet/internal/recordings"
+	"log"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// recordingFile is an open daily file with its writer.
+type recordingFile struct {
+	writer  recordings.Writer
+	day     string
+	pending int
+}
+
+// writerManager keeps the daily files open between messages. The buffered records are
+// flushed and synced to disk every flushInterval or flushEvery records of a file.
+type writerManager struct {
+	mutex         sync.Mutex
+	format        string
+	compression   string
+	flushInterval time.Duration
+	flushEvery    int
+	rotateSize    int64
+	files         map[string]*recordingFile
+	// Buffered records lost with the files discarded after a failure
+	lost int64
+	stop chan struct{}
+	done chan struct{}
+}
+
+func newWriterManager(options brokerConfiguration.FileRecorderConfig) *writerManager {
+	if options.FlushInterval == 0 {
+		options.FlushInterval = 5 * time.Second
+	}
+	if options.FlushEvery == 0 {
+		options.FlushEvery = 100
+	}
+
+	return &writerManager{
+		format:        options.Format,
+		compression:   options.Compression,
+		flushInterval: options.FlushInterval,
+		flushEvery:    options.FlushEvery,
+		rotateSize:    options.RotateSize,
+		files:         make(map[string]*recordingFile),
+		stop:          make(chan struct{}),
+		done:          make(chan struct{}),
+	}
+}
+
+func (m *writerManager) write(path string, day string, record recordings.Record) error {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	f, ok := m.files[path]
+	if !ok {
+		var err error
+		f, err = m.open(path, day)
+		if err != nil {
+			return err
+		}
+		m.files[path] = f
+	}
+
+	// A file above the rotation size is kept as the next part of the day
+	if m.rotateSize > 0 && f.writer.Size() >= m.rotateSize {
+		err := f.writer.Close()
+		if err != nil {
+			return err
+		}
+		delete(m.files, path)
+
+		part := recordings.NextPartPath(path)
+		err = os.Rename(path, part)
+		if err != nil {
+			return err
+		}
+		writeChecksum(part)
+
+		f, err = m.open(path, day)
+		if err != nil {
+			return err
+		}
+		m.files[path] = f
+	}
+
+	err := f.writer.Write(record)
+	if err != nil {
+		m.discard(path, f)
+		return err
+	}
+
+	f.pending++
+	if f.pending >= m.flushEvery {
+		err = f.sync(record.Time)
+		if err != nil {
+			// The record is left to the caller
+			f.pending--
+			m.discard(path, f)
+			return err
+		}
+	}
+	return nil
+}
+
+// discard closes a file after a failed write, losing the records it still buffered, and
+// cuts the partial line the failure may have left so that it can be reopened.
+func (m *writerManager) discard(path string, f *recordingFile) {
+	f.writer.Close()
+	delete(m.files, path)
+	m.lost += int64(f.pending)
+
+	_, err := recordings.Repair(path)
+	if err != nil && !os.IsNotExist(err) {
+		log.Printf("Failed to repair %s: %v\n", path, err)
+	}
+}
+
+func (m *writerManager) lostRecords() int64 {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	return m.lost
+}
+
+func (m *writerManager) open(path string, day string) (*recordingFile, error) {
+	err := os.MkdirAll(filepath.Dir(path), 0755)
+	if err != nil {
+		return nil, err
+	}
+
+	writer, err := recordings.OpenWriter(path, m.format, m.compression)
+	if err != nil {
+		return nil, err
+	}
+
+	// A file reopened for late records is no longer the one of its manifest
+	err = os.Remove(path + recordings.ChecksumExtension)
+	if err != nil && !os.IsNotExist(err) {
+		log.Printf("Failed to remove the manifest of %s: %v\n", path, err)
+	}
+	return &recordingFile{writer: writer, day: day}, nil
+}
+
+func (f *recordingFile) sync(now time.Time) error {
+	err := f.writer.Sync(now)
+	if err == nil {
+		f.pending = 0
+	}
+	return err
+}
+
+// flush syncs every file with buffered records and closes the files of the days
+// before today.
+func (m *writerManager) flush(now time.Time) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	today := now.In(recordings.SensorZone).Format("2006-01-02")
+	for path, f := range m.files {
+		if f.day < today {
+			err := f.writer.Close()
+			if err != nil {
+				log.Printf("Failed to close %s: %v\n", path, err)
+			} else {
+				writeChecksum(path)
+			}
+			delete(m.files, path)
+			continue
+		}
+
+		err := f.sync(now)
+		if err != nil {
+			log.Printf("Failed to flush %s, %d records lost: %v\n", path, f.pending, err)
+			m.discard(path, f)
+		}
+	}
+}
+
+// syncFiles syncs every file with buffered records and returns the first failure, the
+// files that failed are discarded.
+func (m *writerManager) syncFiles(now time.Time) error {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	var failure error
+	for path, f := range m.files {
+		if f.pending == 0 {
+			continue
+		}
+		err := f.sync(now)
+		if err != nil {
+			m.discard(path, f)
+			if failure == nil {
+				failure = err
+			}
+		}
+	}
+	return failure
+}
+
+// compress compresses a file that is not open, holding the lock so that a late record
+// of its day cannot be appended while it is replaced.
+func (m *writerManager) compress(path string, method string) (string, error) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	if _, ok := m.files[path]; ok {
+		return "", nil
+	}
+
+	compressed, err := recordings.CompressFile(path, method)
+	if err != nil {
+		return "", err
+	}
+	os.Remove(path + recordings.ChecksumExtension)
+	writeChecksum(compressed)
+	return compressed, nil
+}
+
+// compact drops the previous footers of a Parquet file that is not open, holding the lock
+// like compress. It returns false when the file was left as it is.
+func (m *writerManager) compact(path string) (bool, error) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	if _, ok := m.files[path]; ok {
+		return false, nil
+	}
+
+	compacted, err := recordings.CompactParquet(path)
+	if err != nil || !compacted {
+		return false, err
+	}
+	os.Remove(path + recordings.ChecksumExtension)
+	writeChecksum(path)
+	return true, nil
+}
+
+// writeChecksum writes the manifest of a file that is complete, after its rotation, the
+// end of its day or its compression.
+func writeChecksum(path string) {
+	err := recordings.WriteChecksum(path)
+	if err != nil {
+		log.Printf("Failed to write the manifest of %s: %v\n", path, err)
+	}
+}
+
+func (m *writerManager) run() {
+	defer close(m.done)
+
+	ticker := time.NewTicker(m.flushInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case now := <-ticker.C:
+			m.flush(now)
+		case <-m.stop:
+			return
+		}
+	}
+}
+
+// close stops the flush loop, then flushes and closes every file.
+func (m *writerManager) close() {
+	close(m.stop)
+	<-m.done
+	m.closeFiles()
+}
+
+func (m *writerManager) closeFiles() {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	for path, f := range m.files {
+		err := f.writer.Close()
+		if err != nil {
+			log.Printf("Failed to close %s: %v\n", path, err)
+		}
+		delete(m.files, path)
+	}
+}
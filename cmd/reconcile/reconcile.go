@@ -0,0 +1,326 @@
+package main
+
+import (
+	brokerconfiguration "ArchiD-Projet/internal/brokerConfiguration"
+	"ArchiD-Projet/internal/influxstore"
+	"ArchiD-Projet/internal/recordings"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"github.com/joho/godotenv"
+	"io"
+	"log"
+	"math"
+	"os"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
+)
+
+// Kinds of discrepancies
+const (
+	MissingInInfluxDB   = "missing_in_influxdb"
+	MissingInFiles      = "missing_in_files"
+	Mismatch            = "mismatch"
+	DuplicateInFiles    = "duplicate_in_files"
+	DuplicateInInfluxDB = "duplicate_in_influxdb"
+)
+
+// A Discrepancy is a timestamp of a measurement on which the files and InfluxDB disagree,
+// with the values found on each side.
+type Discrepancy struct {
+	Kind        string    `json:"kind"`
+	Measurement string    `json:"measurement"`
+	Time        time.Time `json:"time"`
+	Files       []float64 `json:"files"`
+	InfluxDB    []float64 `json:"influxdb"`
+}
+
+type Report struct {
+	Airport      string    `json:"airport"`
+	From         time.Time `json:"from"`
+	To           time.Time `json:"to"`
+	Files        int       `json:"files"`
+	FileReadings int       `json:"fileReadings"`
+	InfluxPoints int       `json:"influxPoints"`
+	// Readings recorded again in the files with the same value, not discrepancies
+	Repeats       int            `json:"repeats"`
+	Counts        map[string]int `json:"counts"`
+	Discrepancies []Discrepancy  `json:"discrepancies"`
+	// Points written to InfluxDB by the repair
+	Repaired int `json:"repaired"`
+}
+
+// reconcile compares the readings of an airport in [from, to) found in the files with the
+// points of InfluxDB, queried one day at a time. Values closer than tolerance match.
+func reconcile(store influxstore.Store, files []recordings.File, airport string, from time.Time, to time.Time, tolerance float64) (Report, error) {
+	report := Report{Airport: airport, From: from, To: to, Files: len(files), Counts: make(map[string]int), Discrepancies: []Discrepancy{}}
+
+	fileValues := make(map[influxstore.Key][]float64)
+	for _, file := range files {
+		records, err := recordings.ReadFile(file.Path, file.Airport)
+		if err != nil {
+			return report, fmt.Errorf("error reading %s: %w", file.Path, err)
+		}
+		for _, record := range records {
+			if record.Time.Before(from) || !record.Time.Before(to) {
+				continue
+			}
+			key := influxstore.Key{Measurement: record.Measurement, Time: record.Time.UnixNano()}
+			fileValues[key] = append(fileValues[key], record.Value)
+			report.FileReadings++
+		}
+	}
+
+	influxValues := make(map[influxstore.Key][]float64)
+	for day := from; day.Before(to); day = day.AddDate(0, 0, 1) {
+		end := day.AddDate(0, 0, 1)
+		if end.After(to) {
+			end = to
+		}
+		points, err := store.Query(day, end, []string{airport}, nil)
+		if err != nil {
+			return report, fmt.Errorf("error querying %s on %s: %w", airport, day.Format("2006-01-02"), err)
+		}
+		// A timestamp stored in more than one series has several values
+		for _, point := range points {
+			influxValues[point.Key()] = append(influxValues[point.Key()], point.Value)
+		}
+		report.InfluxPoints += len(points)
+	}
+
+	add := func(kind string, key influxstore.Key) {
+		report.Counts[kind]++
+		report.Discrepancies = append(report.Discrepancies, Discrepancy{
+			Kind:        kind,
+			Measurement: key.Measurement,
+			Time:        time.Unix(0, key.Time).In(recordings.SensorZone),
+			Files:       fileValues[key],
+			InfluxDB:    influxValues[key],
+		})
+	}
+	for key, values := range fileValues {
+		// Sensors republish an observation until the next one, its repeats are expected
+		if len(values) > 1 {
+			if allEqual(values, tolerance) {
+				report.Repeats += len(values) - 1
+			} else {
+				add(DuplicateInFiles, key)
+			}
+		}
+		stored := influxValues[key]
+		if len(stored) == 0 {
+			add(MissingInInfluxDB, key)
+			continue
+		}
+		for _, value := range values {
+			if !containsValue(stored, value, tolerance) {
+				add(Mismatch, key)
+				break
+			}
+		}
+	}
+	for key, values := range influxValues {
+		if len(values) > 1 {
+			add(DuplicateInInfluxDB, key)
+		}
+		if len(fileValues[key]) == 0 {
+			add(MissingInFiles, key)
+		}
+	}
+
+	sort.Slice(report.Discrepancies, func(i, j int) bool {
+		a, b := report.Discrepancies[i], report.Discrepancies[j]
+		if !a.Time.Equal(b.Time) {
+			return a.Time.Before(b.Time)
+		}
+		if a.Measurement != b.Measurement {
+			return a.Measurement < b.Measurement
+		}
+		return a.Kind < b.Kind
+	})
+	return report, nil
+}
+
+func containsValue(values []float64, value float64, tolerance float64) bool {
+	for _, v := range values {
+		if math.Abs(v-value) <= tolerance {
+			return true
+		}
+	}
+	return false
+}
+
+// repair writes to InfluxDB the readings of the files it is missing or stores with
+// another value, batchSize points at a time. The timestamps with different values in the
+// files are left alone since the right one is unknown.
+func repair(store influxstore.Store, report *Report, batchSize int, tolerance float64) (int, error) {
+	var batch []influxstore.Point
+	skipped := 0
+	for _, discrepancy := range report.Discrepancies {
+		if discrepancy.Kind != MissingInInfluxDB && discrepancy.Kind != Mismatch {
+			continue
+		}
+		value := discrepancy.Files[0]
+		if !allEqual(discrepancy.Files, tolerance) {
+			skipped++
+			continue
+		}
+
+		batch = append(batch, influxstore.Point{Airport: report.Airport, Measurement: discrepancy.Measurement, Time: discrepancy.Time, Value: value})
+		if len(batch) >= batchSize {
+			err := store.Write(batch)
+			if err != nil {
+				return skipped, fmt.Errorf("error writing points: %w", err)
+			}
+			report.Repaired += len(batch)
+			batch = nil
+		}
+	}
+
+	if len(batch) > 0 {
+		err := store.Write(batch)
+		if err != nil {
+			return skipped, fmt.Errorf("error writing points: %w", err)
+		}
+		report.Repaired += len(batch)
+	}
+	return skipped, nil
+}
+
+func allEqual(values []float64, tolerance float64) bool {
+	for _, value := range values[1:] {
+		if math.Abs(value-values[0]) > tolerance {
+			return false
+		}
+	}
+	return true
+}
+
+// writeReport writes the counts of the report and its first maxDiscrepancies
+// discrepancies, all of them when it is 0.
+func writeReport(output io.Writer, report Report, maxDiscrepancies int) error {
+	writer := tabwriter.NewWriter(output, 0, 0, 2, ' ', 0)
+	fmt.Fprintf(writer, "%s from %s to %s: %d files, %d readings in the files (%d repeated), %d points in InfluxDB\n\n",
+		report.Airport, report.From.Format("2006-01-02"), report.To.Format("2006-01-02"), report.Files, report.FileReadings, report.Repeats, report.InfluxPoints)
+	for _, kind := range []string{MissingInInfluxDB, MissingInFiles, Mismatch, DuplicateInFiles, DuplicateInInfluxDB} {
+		fmt.Fprintf(writer, "%s\t%d\n", kind, report.Counts[kind])
+	}
+	if report.Repaired > 0 {
+		fmt.Fprintf(writer, "repaired\t%d\n", report.Repaired)
+	}
+
+	if len(report.Discrepancies) > 0 {
+		fmt.Fprintln(writer, "\nKIND\tMEASUREMENT\tTIME\tFILES\tINFLUXDB")
+	}
+	for i, discrepancy := range report.Discrepancies {
+		if maxDiscrepancies > 0 && i == maxDiscrepancies {
+			fmt.Fprintf(writer, "... %d more\n", len(report.Discrepancies)-i)
+			break
+		}
+		fmt.Fprintf(writer, "%s\t%s\t%s\t%s\t%s\n", discrepancy.Kind, discrepancy.Measurement,
+			discrepancy.Time.Format("2006-01-02 15:04:05"), formatValues(discrepancy.Files), formatValues(discrepancy.InfluxDB))
+	}
+	return writer.Flush()
+}
+
+func formatValues(values []float64) string {
+	if len(values) == 0 {
+		return "-"
+	}
+	formatted := make([]string, len(values))
+	for i, value := range values {
+		formatted[i] = fmt.Sprint(value)
+	}
+	return strings.Join(formatted, ",")
+}
+
+func main() {
+	recorderConfig := brokerconfiguration.GetFileRecorderConfig()
+	dir := flag.String("dir", recorderConfig.RecordingPath, "Directory of the filerecorder recordings")
+	pathTemplate := flag.String("pathTemplate", recorderConfig.PathTemplate, "Path template of the recordings in the directory")
+	hive := flag.Bool("hive", recorderConfig.HivePartitions, "The recordings use Hive partition directories")
+	airport := flag.String("airport", "", "Airport to reconcile")
+	from := flag.String("from", "", "First day to reconcile (yyyy-mm-dd)")
+	to := flag.String("to", "", "Last day to reconcile, excluded (yyyy-mm-dd)")
+	tolerance := flag.Float64("tolerance", 1e-6, "Largest difference between matching values")
+	repairInflux := flag.Bool("repair", false, "Write to InfluxDB the readings of the files it is missing or stores with another value")
+	batchSize := flag.Int("batch", 5000, "Number of points written to InfluxDB at once")
+	format := flag.String("format", "text", "Report format: text or json")
+	maxDiscrepancies := flag.Int("max", 50, "Number of discrepancies listed in the text report, 0 for all")
+	flag.Parse()
+
+	if *airport == "" {
+		log.Fatal("Missing airport")
+		return
+	}
+	start, err := time.ParseInLocation("2006-01-02", *from, recordings.SensorZone)
+	if err != nil {
+		log.Fatal("Invalid start date:", err)
+		return
+	}
+	end, err := time.ParseInLocation("2006-01-02", *to, recordings.SensorZone)
+	if err != nil {
+		log.Fatal("Invalid end date:", err)
+		return
+	}
+	if *batchSize <= 0 {
+		log.Fatal("The batch size must be positive")
+		return
+	}
+
+	layout, err := recordings.NewLayout(*pathTemplate, *hive, "")
+	if err != nil {
+		log.Fatal("Invalid recording path template:", err)
+		return
+	}
+	files, err := recordings.Find(*dir, layout, start, end, []string{*airport})
+	if err != nil {
+		log.Fatal("Error listing the recordings:", err)
+		return
+	}
+
+	err = godotenv.Load()
+	if err != nil {
+		log.Println("No .env file loaded:", err)
+	}
+	store, err := influxstore.NewClient()
+	if err != nil {
+		log.Fatal("Error connecting to InfluxDB:", err)
+		return
+	}
+	defer store.Close()
+
+	report, err := reconcile(store, files, *airport, start, end, *tolerance)
+	if err != nil {
+		log.Fatal("Reconciliation failed:", err)
+		return
+	}
+	if *repairInflux {
+		skipped, err := repair(store, &report, *batchSize, *tolerance)
+		if skipped > 0 {
+			log.Printf("%d readings with different values in the files not repaired\n", skipped)
+		}
+		if err != nil {
+			log.Fatal("Repair failed:", err)
+			return
+		}
+	}
+
+	if *format == "json" {
+		encoder := json.NewEncoder(os.Stdout)
+		encoder.SetIndent("", "  ")
+		err = encoder.Encode(report)
+	} else {
+		err = writeReport(os.Stdout, report, *maxDiscrepancies)
+	}
+	if err != nil {
+		log.Fatal("Error writing the report:", err)
+		return
+	}
+	// Each repaired point fixes one discrepancy
+	if len(report.Discrepancies) > report.Repaired {
+		os.Exit(1)
+	}
+}
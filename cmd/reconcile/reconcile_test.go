@@ -0,0 +1,78 @@
+package main
+
+import (
+	"ArchiD-Projet/internal/influxstore"
+	"ArchiD-Projet/internal/recordings"
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestReconcile(t *testing.T) {
+	dir := t.TempDir()
+	day := time.Date(2024, 1, 19, 0, 0, 0, 0, recordings.SensorZone)
+	at := func(minute int) time.Time {
+		return day.Add(10*time.Hour + time.Duration(minute)*time.Minute)
+	}
+
+	// 10:01 is recorded twice with different values, 10:03 twice with the same value
+	os.WriteFile(filepath.Join(dir, "MRS_2024-01-19.csv"), []byte("2024-01-19 10:00:00 wind 8.000000\n2024-01-19 10:01:00 wind 9.000000\n2024-01-19 10:02:00 wind 10.000000\n2024-01-19 10:03:00 wind 11.000000\n"), 0644)
+	part := recordings.Header(recordings.FormatCSV)
+	for _, record := range []recordings.Record{{Time: at(1), Value: 9.5}, {Time: at(3), Value: 11}, {Time: at(4), Value: 12}} {
+		record.Airport, record.Measurement = "MRS", "wind"
+		part = append(part, recordings.Format(recordings.FormatCSV, record)...)
+	}
+	os.WriteFile(filepath.Join(dir, "MRS_2024-01-19.1.csv"), part, 0644)
+
+	layout, _ := recordings.NewLayout("", false, "")
+	files, _ := recordings.Find(dir, layout, day, day.AddDate(0, 0, 2), []string{"MRS"})
+	store := &influxstore.Memory{Points: []influxstore.Point{
+		{Airport: "MRS", Measurement: "wind", Time: at(0), Value: 8},
+		{Airport: "MRS", Measurement: "wind", Time: at(1), Value: 9},
+		{Airport: "MRS", Measurement: "wind", Time: at(2), Value: 10.5},
+		{Airport: "MRS", Measurement: "wind", Time: at(5), Value: 13},
+		{Airport: "MRS", Measurement: "wind", Time: at(5), Value: 13},
+		{Airport: "MRS", Measurement: "pressure", Time: at(0), Value: 1013},
+		{Airport: "LYS", Measurement: "wind", Time: at(6), Value: 4},
+	}}
+
+	report, err := reconcile(store, files, "MRS", day, day.AddDate(0, 0, 2), 1e-6)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if store.Queries != 2 || report.FileReadings != 7 || report.Repeats != 1 || report.InfluxPoints != 6 {
+		t.Errorf("unexpected totals %+v after %d queries", report, store.Queries)
+	}
+	expected := map[string]int{MissingInInfluxDB: 2, MissingInFiles: 2, Mismatch: 2, DuplicateInFiles: 1, DuplicateInInfluxDB: 1}
+	for kind, count := range expected {
+		if report.Counts[kind] != count {
+			t.Errorf("expected %d %s, got %d", count, kind, report.Counts[kind])
+		}
+	}
+	first := report.Discrepancies[0]
+	if first.Kind != MissingInFiles || first.Measurement != "pressure" || !first.Time.Equal(at(0)) {
+		t.Errorf("unexpected first discrepancy %+v", first)
+	}
+
+	// 10:02 is overwritten, 10:03 and 10:04 added, 10:01 is ambiguous
+	skipped, err := repair(store, &report, 1, 1e-6)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if skipped != 1 || report.Repaired != 3 || len(store.Batches) != 3 {
+		t.Fatalf("expected 3 points repaired and 1 skipped, got %d batches and %d skipped", len(store.Batches), skipped)
+	}
+	point := store.Batches[0][0]
+	if point.Airport != "MRS" || point.Measurement != "wind" || point.Value != 10 || !point.Time.Equal(at(2)) {
+		t.Errorf("unexpected point %+v", point)
+	}
+
+	var output bytes.Buffer
+	writeReport(&output, report, 3)
+	if !strings.Contains(output.String(), "mismatch               2") || !strings.Contains(output.String(), "... 5 more") {
+		t.Errorf("unexpected report:\n%s", output.String())
+	}
+}
@@ -0,0 +1,278 @@
+package main
+
+import (
+	"ArchiD-Projet/internal/alerts"
+	brokerconfiguration "ArchiD-Projet/internal/brokerConfiguration"
+	"ArchiD-Projet/internal/mqttconnect"
+	"encoding/json"
+	mqtt "github.com/eclipse/paho.mqtt.golang"
+	"github.com/gin-gonic/gin"
+	"log"
+	"net/http"
+	"sync"
+	"time"
+)
+
+var (
+	alertManagerTopics = brokerconfiguration.GetAlertManagerTopics()
+	COMMAND_TOPIC      = alertManagerTopics[2]
+	STATE_TOPIC        = alertManagerTopics[3]
+	mqttClient         *mqttconnect.Client
+	alertState         alerts.State
+	alertStateMutex    sync.RWMutex
+)
+
+// connectAlertManager keeps a copy of the retained alert manager state and is used to send commands.
+func connectAlertManager() error {
+	client, err := mqttconnect.NewClient(brokerconfiguration.GetBrokerAddress(), "rest_api", nil)
+	if err != nil {
+		return err
+	}
+
+	err = client.Subscribe(STATE_TOPIC, 1, onAlertStateReceived)
+	if err != nil {
+		return err
+	}
+
+	mqttClient = client
+	return nil
+}
+
+func onAlertStateReceived(_ mqtt.Client, message mqtt.Message) {
+	var received alerts.State
+	err := json.Unmarshal(message.Payload(), &received)
+	if err != nil {
+		log.Println("Error decoding alert manager state:", err)
+		return
+	}
+
+	alertStateMutex.Lock()
+	alertState = received
+	alertStateMutex.Unlock()
+}
+
+func getAlertState() alerts.State {
+	alertStateMutex.RLock()
+	defer alertStateMutex.RUnlock()
+	return alertState
+}
+
+func sendCommand(command string, payload interface{}) error {
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+	return mqttClient.Publish(COMMAND_TOPIC+command, 1, false, body)
+}
+
+// @BasePath /
+// @Summary Get all active and upcoming silences
+// @Description Get all active and upcoming silences
+// @Accept json
+// @Produce json
+// @Success 200 {array} alerts.Silence
+// @Router /silences [get]
+func getSilences(c *gin.Context) {
+	c.Writer.Header().Add("Access-Control-Allow-Origin", "*")
+
+	silences := getAlertState().Silences
+	if silences == nil {
+		silences = []alerts.Silence{}
+	}
+	c.IndentedJSON(http.StatusOK, silences)
+}
+
+// @BasePath /
+// @Summary Create a silence
+// @Description Create a silence for the alerts matching an airport, a measurement and a rule between two dates
+// @Accept json
+// @Produce json
+// @Param silence body alerts.Silence true "Silence"
+// @Success 202 {object} alerts.Silence
+// @Router /silences [post]
+func postSilence(c *gin.Context) {
+	c.Writer.Header().Add("Access-Control-Allow-Origin", "*")
+
+	var silence alerts.Silence
+	err := c.ShouldBindJSON(&silence)
+	if err != nil {
+		c.IndentedJSON(http.StatusBadRequest, gin.H{"error": "Invalid silence: " + err.Error()})
+		return
+	}
+
+	err = silence.Validate()
+	if err != nil {
+		c.IndentedJSON(http.StatusBadRequest, gin.H{"error": "Invalid silence: " + err.Error()})
+		return
+	}
+
+	if mqttClient == nil {
+		c.IndentedJSON(http.StatusServiceUnavailable, gin.H{"error": "Alert manager is not reachable"})
+		return
+	}
+
+	silence.ID = alerts.NewID()
+	err = sendCommand("silences", silence)
+	if err != nil {
+		c.IndentedJSON(http.StatusInternalServerError, gin.H{"error": "Error sending silence to the alert manager"})
+		return
+	}
+
+	c.IndentedJSON(http.StatusAccepted, silence)
+}
+
+type acknowledgementRequest struct {
+	By      string `json:"by" binding:"required"`
+	Comment string `json:"comment"`
+}
+
+// @BasePath /
+// @Summary Get the alert history
+// @Description Get the alerts raised by the alert manager, most recent first, with their acknowledgement status
+// @Accept json
+// @Produce json
+// @Param airport query string false "Airport IATA code"
+// @Param status query string false "Alert status (firing or resolved)"
+// @Success 200 {array} alerts.Alert
+// @Router /alerts [get]
+func getAlerts(c *gin.Context) {
+	c.Writer.Header().Add("Access-Control-Allow-Origin", "*")
+
+	airportIATA := c.Query("airport")
+	status := c.Query("status")
+
+	history := getAlertState().History
+	ret := []alerts.Alert{}
+	for i := len(history) - 1; i >= 0; i-- {
+		alert := history[i]
+		if (airportIATA == "" || alert.Airport == airportIATA) && (status == "" || alert.Status == status) {
+			ret = append(ret, alert)
+		}
+	}
+	c.IndentedJSON(http.StatusOK, ret)
+}
+
+// @BasePath /
+// @Summary Get an alert
+// @Description Get an alert by ID
+// @Accept json
+// @Produce json
+// @Param id path string true "Alert ID"
+// @Success 200 {object} alerts.Alert
+// @Router /alerts/{id} [get]
+func getAlertByID(c *gin.Context) {
+	c.Writer.Header().Add("Access-Control-Allow-Origin", "*")
+
+	alert, ok := findAlert(c.Param("id"))
+	if !ok {
+		c.IndentedJSON(http.StatusNotFound, gin.H{"message": "No alert found for the specified ID"})
+		return
+	}
+	c.IndentedJSON(http.StatusOK, alert)
+}
+
+// @BasePath /
+// @Summary Acknowledge an alert
+// @Description Acknowledge a firing alert, its notifications stop until it resolves or escalates
+// @Accept json
+// @Produce json
+// @Param id path string true "Alert ID"
+// @Param acknowledgement body acknowledgementRequest true "Acknowledgement"
+// @Success 202 {object} alerts.Acknowledgement
+// @Router /alerts/{id}/ack [post]
+func postAlertAcknowledgement(c *gin.Context) {
+	c.Writer.Header().Add("Access-Control-Allow-Origin", "*")
+
+	var request acknowledgementRequest
+	err := c.ShouldBindJSON(&request)
+	if err != nil {
+		c.IndentedJSON(http.StatusBadRequest, gin.H{"error": "Invalid acknowledgement: " + err.Error()})
+		return
+	}
+
+	alert, ok := findAlert(c.Param("id"))
+	if !ok {
+		c.IndentedJSON(http.StatusNotFound, gin.H{"message": "No alert found for the specified ID"})
+		return
+	}
+	if alert.Status != alerts.StatusFiring {
+		c.IndentedJSON(http.StatusConflict, gin.H{"error": "Only firing alerts can be acknowledged"})
+		return
+	}
+
+	if mqttClient == nil {
+		c.IndentedJSON(http.StatusServiceUnavailable, gin.H{"error": "Alert manager is not reachable"})
+		return
+	}
+
+	ack := alerts.Acknowledgement{AlertID: alert.ID, By: request.By, Comment: request.Comment, At: time.Now()}
+	err = sendCommand("ack", ack)
+	if err != nil {
+		c.IndentedJSON(http.StatusInternalServerError, gin.H{"error": "Error sending acknowledgement to the alert manager"})
+		return
+	}
+
+	c.IndentedJSON(http.StatusAccepted, ack)
+}
+
+func findAlert(id string) (alerts.Alert, bool) {
+	state := getAlertState()
+	// Long firing alerts can be older than the whole history
+	for _, alert := range state.Active {
+		if alert.ID == id {
+			return alert, true
+		}
+	}
+	for _, alert := range state.History {
+		if alert.ID == id {
+			return alert, true
+		}
+	}
+	return alerts.Alert{}, false
+}
+
+// @BasePath /
+// @Summary Get the incidents
+// @Description Get the incidents grouping the alerts of an airport, most recent first
+// @Accept json
+// @Produce json
+// @Param airport query string false "Airport IATA code"
+// @Param status query string false "Incident status (open or resolved)"
+// @Success 200 {array} alerts.Incident
+// @Router /incidents [get]
+func getIncidents(c *gin.Context) {
+	c.Writer.Header().Add("Access-Control-Allow-Origin", "*")
+
+	airportIATA := c.Query("airport")
+	status := c.Query("status")
+
+	incidents := getAlertState().Incidents
+	ret := []alerts.Incident{}
+	for i := len(incidents) - 1; i >= 0; i-- {
+		incident := incidents[i]
+		if (airportIATA == "" || incident.Airport == airportIATA) && (status == "" || incident.Status == status) {
+			ret = append(ret, incident)
+		}
+	}
+	c.IndentedJSON(http.StatusOK, ret)
+}
+
+// @BasePath /
+// @Summary Get an incident
+// @Description Get an incident by ID with the timeline of its member alerts
+// @Accept json
+// @Produce json
+// @Param id path string true "Incident ID"
+// @Success 200 {object} alerts.Incident
+// @Router /incidents/{id} [get]
+func getIncidentByID(c *gin.Context) {
+	c.Writer.Header().Add("Access-Control-Allow-Origin", "*")
+
+	for _, incident := range getAlertState().Incidents {
+		if incident.ID == c.Param("id") {
+			c.IndentedJSON(http.StatusOK, incident)
+			return
+		}
+	}
+	c.IndentedJSON(http.StatusNotFound, gin.H{"message": "No incident found for the specified ID"})
+}
@@ -90,6 +90,11 @@ func main() {
 
 	docs.SwaggerInfo.BasePath = "/"
 
+	err := connectAlertManager()
+	if err != nil {
+		log.Println("Error connecting to the alert manager:", err)
+	}
+
 	router.GET("/airports", getAllAirports)
 	router.GET("/airports/data/", getAllAirportsData)
 	router.GET("/airport/:iata/data/", getAirportDataByIATA)
@@ -97,10 +102,17 @@ func main() {
 	router.GET("/airport/:iata/data/range/:start/:end/:measurement", getAirportDataByDateRangesAndType)
 	router.GET("/airport/:iata/average/:date", getAirportDataAverageByDate)
 	router.GET("/airport/:iata/average/:date/:measurement", getAirportDataAverageByDateAndType)
+	router.GET("/silences", getSilences)
+	router.POST("/silences", postSilence)
+	router.GET("/alerts", getAlerts)
+	router.GET("/alerts/:id", getAlertByID)
+	router.POST("/alerts/:id/ack", postAlertAcknowledgement)
+	router.GET("/incidents", getIncidents)
+	router.GET("/incidents/:id", getIncidentByID)
 
 	router.GET("/swagger/*any", ginSwagger.WrapHandler(swaggerfiles.Handler))
 
-	err := router.Run("localhost:8080")
+	err = router.Run("localhost:8080")
 	if err != nil {
 		log.Fatal("Error starting Gin router:", err)
 	}
@@ -4,6 +4,7 @@ import (
 	"github.com/gin-gonic/gin"
 	"net/http"
 	"net/http/httptest"
+	"strings"
 	"testing"
 )
 
@@ -119,6 +120,87 @@ func TestGetAirportDataAverageByDateAndType(t *testing.T) {
 	}
 }
 
+func TestGetSilences(t *testing.T) {
+	req, err := http.NewRequest("GET", "/silences", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rr := httptest.NewRecorder()
+	router := setupRouter()
+	router.ServeHTTP(rr, req)
+
+	if status := rr.Code; status != http.StatusOK {
+		t.Errorf("handler returned wrong status code: got %v want %v",
+			status, http.StatusOK)
+	}
+}
+
+func TestPostInvalidSilence(t *testing.T) {
+	body := `{"airport": "MRS", "startsAt": "2024-01-19T12:00:00Z", "endsAt": "2024-01-19T10:00:00Z"}`
+	req, err := http.NewRequest("POST", "/silences", strings.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rr := httptest.NewRecorder()
+	router := setupRouter()
+	router.ServeHTTP(rr, req)
+
+	if status := rr.Code; status != http.StatusBadRequest {
+		t.Errorf("handler returned wrong status code: got %v want %v",
+			status, http.StatusBadRequest)
+	}
+}
+
+func TestGetAlerts(t *testing.T) {
+	req, err := http.NewRequest("GET", "/alerts?airport=MRS", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rr := httptest.NewRecorder()
+	router := setupRouter()
+	router.ServeHTTP(rr, req)
+
+	if status := rr.Code; status != http.StatusOK {
+		t.Errorf("handler returned wrong status code: got %v want %v",
+			status, http.StatusOK)
+	}
+}
+
+func TestAcknowledgeUnknownAlert(t *testing.T) {
+	req, err := http.NewRequest("POST", "/alerts/unknown/ack", strings.NewReader(`{"by": "duty"}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rr := httptest.NewRecorder()
+	router := setupRouter()
+	router.ServeHTTP(rr, req)
+
+	if status := rr.Code; status != http.StatusNotFound {
+		t.Errorf("handler returned wrong status code: got %v want %v",
+			status, http.StatusNotFound)
+	}
+}
+
+func TestGetUnknownIncident(t *testing.T) {
+	req, err := http.NewRequest("GET", "/incidents/unknown", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rr := httptest.NewRecorder()
+	router := setupRouter()
+	router.ServeHTTP(rr, req)
+
+	if status := rr.Code; status != http.StatusNotFound {
+		t.Errorf("handler returned wrong status code: got %v want %v",
+			status, http.StatusNotFound)
+	}
+}
+
 func setupRouter() *gin.Engine {
 	router := gin.Default()
 
@@ -129,6 +211,13 @@ func setupRouter() *gin.Engine {
 	router.GET("/airport/:iata/data/range/:start/:end/:measurement", getAirportDataByDateRangesAndType)
 	router.GET("/airport/:iata/average/:date", getAirportDataAverageByDate)
 	router.GET("/airport/:iata/average/:date/:measurement", getAirportDataAverageByDateAndType)
+	router.GET("/silences", getSilences)
+	router.POST("/silences", postSilence)
+	router.GET("/alerts", getAlerts)
+	router.GET("/alerts/:id", getAlertByID)
+	router.POST("/alerts/:id/ack", postAlertAcknowledgement)
+	router.GET("/incidents", getIncidents)
+	router.GET("/incidents/:id", getIncidentByID)
 
 	return router
 }
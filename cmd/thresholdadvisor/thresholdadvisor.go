@@ -0,0 +1,357 @@
+package main
+
+import (
+	"ArchiD-Projet/internal/airports"
+	"ArchiD-Projet/internal/influxstore"
+	"ArchiD-Projet/internal/recordings"
+	"ArchiD-Projet/internal/thresholds"
+	"bytes"
+	"flag"
+	"fmt"
+	"github.com/joho/godotenv"
+	"gopkg.in/yaml.v3"
+	"io"
+	"log"
+	"math"
+	"os"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Keys of the seasonal bands in threshold_config.yml by measurement.
+var thresholdKeys = map[string]string{
+	"temperature": "temp",
+	"pressure":    "pressure",
+}
+
+type reading struct {
+	airport string
+	time    time.Time
+	value   float64
+}
+
+type Statistics struct {
+	Count  int     `yaml:"count"`
+	Min    float64 `yaml:"min"`
+	Max    float64 `yaml:"max"`
+	Mean   float64 `yaml:"mean"`
+	StdDev float64 `yaml:"stddev"`
+	Lower  float64 `yaml:"lower"`
+	Median float64 `yaml:"median"`
+	Upper  float64 `yaml:"upper"`
+}
+
+// Recommendation is written in the layout of threshold_config.yml, the statistics key
+// is ignored by the alert manager. It only holds the seasonal bands, mergeRecommendation
+// writes them into a complete threshold file.
+type Recommendation struct {
+	Temp       *thresholds.SeasonalBounds       `yaml:"temp,omitempty"`
+	Pressure   *thresholds.SeasonalBounds       `yaml:"pressure,omitempty"`
+	Statistics map[string]map[string]Statistics `yaml:"statistics"`
+}
+
+// percentile returns the p-th percentile of sorted values with linear interpolation.
+func percentile(sorted []float64, p float64) float64 {
+	if len(sorted) == 1 {
+		return sorted[0]
+	}
+	rank := p / 100 * float64(len(sorted)-1)
+	lower := int(math.Floor(rank))
+	if lower >= len(sorted)-1 {
+		return sorted[len(sorted)-1]
+	}
+	return sorted[lower] + (rank-float64(lower))*(sorted[lower+1]-sorted[lower])
+}
+
+func computeStatistics(values []float64, lower float64, upper float64) Statistics {
+	sorted := append([]float64(nil), values...)
+	sort.Float64s(sorted)
+
+	var sum, sumSquares float64
+	for _, value := range sorted {
+		sum += value
+		sumSquares += value * value
+	}
+	n := float64(len(sorted))
+	mean := sum / n
+	variance := 0.0
+	if n > 1 {
+		variance = math.Max(0, (sumSquares-n*mean*mean)/(n-1))
+	}
+
+	return Statistics{
+		Count:  len(sorted),
+		Min:    round(sorted[0]),
+		Max:    round(sorted[len(sorted)-1]),
+		Mean:   round(mean),
+		StdDev: round(math.Sqrt(variance)),
+		Lower:  round(percentile(sorted, lower)),
+		Median: round(percentile(sorted, 50)),
+		Upper:  round(percentile(sorted, upper)),
+	}
+}
+
+func round(value float64) float64 {
+	return math.Round(value*100) / 100
+}
+
+// recommend groups the readings of each measurement by season of their airport and
+// proposes the lower and upper percentiles of each season as its band. The readings
+// out of every season of their calendar are left out.
+func recommend(readings map[string][]reading, airportInfo *airports.Config, lower float64, upper float64, severity string) Recommendation {
+	recommendation := Recommendation{Statistics: make(map[string]map[string]Statistics)}
+
+	for measurement, measurementReadings := range readings {
+		bySeason := make(map[string][]float64)
+		skipped := 0
+		for _, r := range measurementReadings {
+			season := airportInfo.Season(r.airport, r.time)
+			if season == "" {
+				skipped++
+				continue
+			}
+			bySeason[season] = append(bySeason[season], r.value)
+		}
+		if skipped > 0 {
+			log.Printf("%d %s readings out of any season left out\n", skipped, measurement)
+		}
+		if len(bySeason) == 0 {
+			continue
+		}
+
+		bounds := &thresholds.SeasonalBounds{Severity: severity, Seasons: make(map[string]thresholds.Bounds)}
+		statistics := make(map[string]Statistics)
+		for season, values := range bySeason {
+			seasonStatistics := computeStatistics(values, lower, upper)
+			statistics[season] = seasonStatistics
+			bounds.Seasons[season] = thresholds.Bounds{Min: seasonStatistics.Lower, Max: seasonStatistics.Upper}
+		}
+
+		key := thresholdKeys[measurement]
+		recommendation.Statistics[key] = statistics
+		switch key {
+		case "temp":
+			recommendation.Temp = bounds
+		case "pressure":
+			recommendation.Pressure = bounds
+		}
+	}
+	return recommendation
+}
+
+func writeRecommendation(output io.Writer, recommendation Recommendation, header string) error {
+	_, err := fmt.Fprint(output, header)
+	if err != nil {
+		return err
+	}
+
+	encoder := yaml.NewEncoder(output)
+	encoder.SetIndent(2)
+	err = encoder.Encode(recommendation)
+	if err != nil {
+		return err
+	}
+	return encoder.Close()
+}
+
+// mergeRecommendation replaces the recommended season bands in a threshold file. The
+// other keys, seasons and comments of the file are kept, and so is the severity of a
+// measurement when the file sets one. The statistics are left out.
+func mergeRecommendation(config []byte, recommendation Recommendation) ([]byte, error) {
+	var document yaml.Node
+	err := yaml.Unmarshal(config, &document)
+	if err != nil {
+		return nil, err
+	}
+	if len(document.Content) == 0 || document.Content[0].Kind != yaml.MappingNode {
+		return nil, fmt.Errorf("the threshold file is not a YAML mapping")
+	}
+	root := document.Content[0]
+
+	sections := []struct {
+		key    string
+		bounds *thresholds.SeasonalBounds
+	}{{"temp", recommendation.Temp}, {"pressure", recommendation.Pressure}}
+	for _, section := range sections {
+		if section.bounds == nil {
+			continue
+		}
+
+		node := mappingValue(root, section.key)
+		if node == nil || node.Kind != yaml.MappingNode {
+			node = &yaml.Node{Kind: yaml.MappingNode, Tag: "!!map"}
+			setMappingValue(root, section.key, node)
+		}
+		if mappingValue(node, "severity") == nil {
+			setMappingValue(node, "severity", &yaml.Node{Kind: yaml.ScalarNode, Value: section.bounds.Severity})
+		}
+
+		var seasons []string
+		for season := range section.bounds.Seasons {
+			seasons = append(seasons, season)
+		}
+		sort.Strings(seasons)
+		for _, season := range seasons {
+			var bounds yaml.Node
+			err = bounds.Encode(section.bounds.Seasons[season])
+			if err != nil {
+				return nil, err
+			}
+			setMappingValue(node, season, &bounds)
+		}
+	}
+
+	var output bytes.Buffer
+	encoder := yaml.NewEncoder(&output)
+	encoder.SetIndent(2)
+	err = encoder.Encode(&document)
+	if err != nil {
+		return nil, err
+	}
+	err = encoder.Close()
+	return output.Bytes(), err
+}
+
+func mappingValue(mapping *yaml.Node, key string) *yaml.Node {
+	for i := 0; i+1 < len(mapping.Content); i += 2 {
+		if mapping.Content[i].Value == key {
+			return mapping.Content[i+1]
+		}
+	}
+	return nil
+}
+
+func setMappingValue(mapping *yaml.Node, key string, value *yaml.Node) {
+	for i := 0; i+1 < len(mapping.Content); i += 2 {
+		if mapping.Content[i].Value == key {
+			mapping.Content[i+1] = value
+			return
+		}
+	}
+	mapping.Content = append(mapping.Content, &yaml.Node{Kind: yaml.ScalarNode, Value: key}, value)
+}
+
+// queryReadings reads the points written by the databaserecorder for the measurements
+// and airports, grouped by measurement.
+func queryReadings(store influxstore.Store, measurements []string, airportList []string, from time.Time, to time.Time) (map[string][]reading, error) {
+	points, err := store.Query(from, to, airportList, measurements)
+	if err != nil {
+		return nil, err
+	}
+
+	readings := make(map[string][]reading)
+	for _, point := range points {
+		readings[point.Measurement] = append(readings[point.Measurement], reading{airport: point.Airport, time: point.Time, value: point.Value})
+	}
+	return readings, nil
+}
+
+func main() {
+	airportList := flag.String("airports", "", "Comma separated airports to analyze, all by default")
+	measurementList := flag.String("measurements", "temperature,pressure", "Comma separated measurements to analyze")
+	from := flag.String("from", time.Now().AddDate(-1, 0, 0).Format("2006-01-02"), "Start of the history (yyyy-mm-dd)")
+	to := flag.String("to", time.Now().Format("2006-01-02"), "End of the history, excluded (yyyy-mm-dd)")
+	lower := flag.Float64("lower", 1, "Percentile of the recommended minimum")
+	upper := flag.Float64("upper", 99, "Percentile of the recommended maximum")
+	severity := flag.String("severity", "warning", "Severity of the recommended rules")
+	outputFile := flag.String("output", "", "File to write the recommended thresholds to, standard output by default")
+	mergeFile := flag.String("merge", "", "Threshold file to merge the recommended bands into, the output is then a complete threshold file")
+	flag.Parse()
+
+	if *lower < 0 || *upper > 100 || *lower >= *upper {
+		log.Fatal("Percentiles must satisfy 0 <= lower < upper <= 100")
+		return
+	}
+
+	measurements := strings.Split(*measurementList, ",")
+	for _, measurement := range measurements {
+		if _, ok := thresholdKeys[measurement]; !ok {
+			log.Fatalf("No seasonal threshold for measurement %s\n", measurement)
+			return
+		}
+	}
+	var airportCodes []string
+	if *airportList != "" {
+		airportCodes = strings.Split(*airportList, ",")
+	}
+
+	// Days start at midnight in the time zone of the sensors, as the recordings
+	start, err := time.ParseInLocation("2006-01-02", *from, recordings.SensorZone)
+	if err != nil {
+		log.Fatal("Invalid start date:", err)
+		return
+	}
+	end, err := time.ParseInLocation("2006-01-02", *to, recordings.SensorZone)
+	if err != nil {
+		log.Fatal("Invalid end date:", err)
+		return
+	}
+
+	airportInfo, err := airports.LoadConfig("config/airport_config.yml")
+	if err != nil {
+		log.Fatal("Error loading airport configuration:", err)
+		return
+	}
+
+	err = godotenv.Load()
+	if err != nil {
+		log.Println("No .env file loaded:", err)
+	}
+	client, err := influxstore.NewClient()
+	if err != nil {
+		log.Fatal("Error connecting to InfluxDB:", err)
+		return
+	}
+	defer client.Close()
+
+	readings, err := queryReadings(client, measurements, airportCodes, start, end)
+	if err != nil {
+		log.Fatal("Error querying InfluxDB:", err)
+		return
+	}
+	if len(readings) == 0 {
+		log.Fatal("No data found for the specified parameters")
+		return
+	}
+
+	scope := "all airports"
+	if len(airportCodes) > 0 {
+		scope = strings.Join(airportCodes, ", ")
+	}
+	recommendation := recommend(readings, airportInfo, *lower, *upper, *severity)
+
+	var merged []byte
+	if *mergeFile != "" {
+		config, err := os.ReadFile(*mergeFile)
+		if err != nil {
+			log.Fatal("Error reading the threshold file:", err)
+			return
+		}
+		merged, err = mergeRecommendation(config, recommendation)
+		if err != nil {
+			log.Fatal("Error merging the recommended thresholds:", err)
+			return
+		}
+	}
+
+	output := os.Stdout
+	if *outputFile != "" {
+		output, err = os.Create(*outputFile)
+		if err != nil {
+			log.Fatal("Error creating output file:", err)
+			return
+		}
+		defer output.Close()
+	}
+
+	if merged != nil {
+		_, err = output.Write(merged)
+	} else {
+		header := fmt.Sprintf("# Thresholds recommended for %s from %s to %s\n# Bands use the percentiles %g (min) and %g (max) of each season\n# Partial thresholds: copy the bands into config/threshold_config.yml or use -merge\n", scope, *from, *to, *lower, *upper)
+		err = writeRecommendation(output, recommendation, header)
+	}
+	if err != nil {
+		log.Fatal("Error writing recommended thresholds:", err)
+	}
+}
@@ -0,0 +1,143 @@
+package main
+
+import (
+	"ArchiD-Projet/internal/airports"
+	"ArchiD-Projet/internal/thresholds"
+	"bytes"
+	"gopkg.in/yaml.v3"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestPercentile(t *testing.T) {
+	sorted := []float64{1, 2, 3, 4, 5}
+	tests := map[float64]float64{0: 1, 25: 2, 50: 3, 90: 4.6, 100: 5}
+	for p, expected := range tests {
+		if got := percentile(sorted, p); got != expected {
+			t.Errorf("percentile(%v) = %v, want %v", p, got, expected)
+		}
+	}
+}
+
+func TestRecommendBySeason(t *testing.T) {
+	airportInfo, err := airports.LoadConfig("../../config/airport_config.yml")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var temperatures []reading
+	for i := 0; i <= 100; i++ {
+		temperatures = append(temperatures,
+			reading{airport: "MRS", time: time.Date(2023, 7, 1, 0, i, 0, 0, time.UTC), value: 290 + float64(i)/10},
+			reading{airport: "MRS", time: time.Date(2023, 1, 1, 0, i, 0, 0, time.UTC), value: 270 + float64(i)/10})
+	}
+
+	recommendation := recommend(map[string][]reading{"temperature": temperatures}, airportInfo, 5, 95, "warning")
+	if recommendation.Temp == nil || recommendation.Pressure != nil {
+		t.Fatalf("unexpected recommendation: %+v", recommendation)
+	}
+	if summer := recommendation.Temp.Seasons["summer"]; summer.Min != 290.5 || summer.Max != 299.5 {
+		t.Errorf("unexpected summer band: %+v", summer)
+	}
+	if winter := recommendation.Temp.Seasons["winter"]; winter.Min != 270.5 || winter.Max != 279.5 {
+		t.Errorf("unexpected winter band: %+v", winter)
+	}
+
+	var output bytes.Buffer
+	err = writeRecommendation(&output, recommendation, "# test\n")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var parsed struct {
+		Temp map[string]interface{} `yaml:"temp"`
+	}
+	err = yaml.Unmarshal(output.Bytes(), &parsed)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if parsed.Temp["severity"] != "warning" || parsed.Temp["summer"] == nil {
+		t.Errorf("unexpected YAML output:\n%s", output.String())
+	}
+}
+
+func TestRecommendSkipsReadingsOutOfSeasons(t *testing.T) {
+	config := filepath.Join(t.TempDir(), "airport_config.yml")
+	err := os.WriteFile(config, []byte("defaultTimezone: UTC\ndefaultCalendar: partial\ncalendars:\n  partial:\n    - name: summer\n      months: [7]\n"), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	airportInfo, err := airports.LoadConfig(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	temperatures := []reading{
+		{airport: "MRS", time: time.Date(2023, 7, 1, 0, 0, 0, 0, time.UTC), value: 290},
+		{airport: "MRS", time: time.Date(2023, 1, 1, 0, 0, 0, 0, time.UTC), value: 270},
+	}
+	recommendation := recommend(map[string][]reading{"temperature": temperatures}, airportInfo, 5, 95, "warning")
+	if recommendation.Temp == nil || len(recommendation.Temp.Seasons) != 1 || len(recommendation.Statistics["temp"]) != 1 {
+		t.Fatalf("unexpected recommendation: %+v", recommendation)
+	}
+	if summer := recommendation.Temp.Seasons["summer"]; summer.Min != 290 || summer.Max != 290 {
+		t.Errorf("unexpected summer band: %+v", summer)
+	}
+}
+
+func TestMergeRecommendation(t *testing.T) {
+	config := `# Alert thresholds
+temp:
+  min: 273.15
+  max: 308.15
+  severity: critical
+wind:
+  speed: 60.0
+pressure:
+  summer:
+    min: 1010.0
+    max: 1028.0
+  autumn:
+    min: 1005.0
+    max: 1040.0
+`
+	recommendation := Recommendation{
+		Temp:     &thresholds.SeasonalBounds{Severity: "warning", Seasons: map[string]thresholds.Bounds{"summer": {Min: 290.5, Max: 299.5}}},
+		Pressure: &thresholds.SeasonalBounds{Severity: "warning", Seasons: map[string]thresholds.Bounds{"summer": {Min: 1008, Max: 1030}, "winter": {Min: 1000, Max: 1045}}},
+	}
+
+	merged, err := mergeRecommendation([]byte(config), recommendation)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.HasPrefix(merged, []byte("# Alert thresholds\n")) || bytes.Contains(merged, []byte("statistics")) {
+		t.Errorf("unexpected merged file:\n%s", merged)
+	}
+
+	var parsed map[string]map[string]interface{}
+	err = yaml.Unmarshal(merged, &parsed)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := map[string]map[string]interface{}{
+		"temp": {"min": 273.15, "max": 308.15, "severity": "critical", "summer": map[string]interface{}{"min": 290.5, "max": 299.5}},
+		"wind": {"speed": 60.0},
+		"pressure": {
+			"severity": "warning",
+			"summer":   map[string]interface{}{"min": 1008, "max": 1030},
+			"autumn":   map[string]interface{}{"min": 1005.0, "max": 1040.0},
+			"winter":   map[string]interface{}{"min": 1000, "max": 1045},
+		},
+	}
+	if !reflect.DeepEqual(parsed, expected) {
+		t.Errorf("merged thresholds %v, want %v", parsed, expected)
+	}
+
+	_, err = mergeRecommendation([]byte("- not a mapping\n"), recommendation)
+	if err == nil {
+		t.Error("merged into a YAML sequence")
+	}
+}
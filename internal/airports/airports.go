@@ -0,0 +1,149 @@
+package airports
+
+import (
+	"fmt"
+	"gopkg.in/yaml.v3"
+	"os"
+	"time"
+)
+
+type Config struct {
+	DefaultTimezone string                 `yaml:"defaultTimezone"`
+	DefaultCalendar string                 `yaml:"defaultCalendar"`
+	Calendars       map[string][]Season    `yaml:"calendars"`
+	Airports        map[string]AirportInfo `yaml:"airports"`
+	locations       map[string]*time.Location
+}
+
+type AirportInfo struct {
+	Timezone string `yaml:"timezone"`
+	Calendar string `yaml:"calendar"`
+	// MagneticVariation is the magnetic declination in degrees, positive east
+	MagneticVariation float64  `yaml:"magneticVariation"`
+	Runways           []Runway `yaml:"runways"`
+}
+
+// A Runway has a magnetic heading in degrees and wind limits in m/s. Its alerts are
+// critical unless Severity is set. A preferred runway stays in use with a tailwind up
+// to TailwindLimit, the other runways are used facing the wind so they have no
+// tailwind limit.
+type Runway struct {
+	Name           string  `yaml:"name"`
+	Heading        float64 `yaml:"heading"`
+	Preferred      bool    `yaml:"preferred"`
+	CrosswindLimit float64 `yaml:"crosswindLimit"`
+	TailwindLimit  float64 `yaml:"tailwindLimit"`
+	Severity       string  `yaml:"severity"`
+}
+
+// A season matches a date by month or by inclusive day-of-year ranges.
+type Season struct {
+	Name   string     `yaml:"name"`
+	Months []int      `yaml:"months"`
+	Days   []DayRange `yaml:"days"`
+}
+
+type DayRange struct {
+	From int `yaml:"from"`
+	To   int `yaml:"to"`
+}
+
+func LoadConfig(filename string) (*Config, error) {
+	var config Config
+
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+
+	err = yaml.Unmarshal(data, &config)
+	if err != nil {
+		return nil, err
+	}
+
+	if _, ok := config.Calendars[config.DefaultCalendar]; !ok {
+		return nil, fmt.Errorf("unknown default calendar %s", config.DefaultCalendar)
+	}
+
+	config.locations = make(map[string]*time.Location)
+	for iata, airport := range config.Airports {
+		if airport.Calendar != "" {
+			if _, ok := config.Calendars[airport.Calendar]; !ok {
+				return nil, fmt.Errorf("unknown calendar %s for airport %s", airport.Calendar, iata)
+			}
+		}
+		for _, runway := range airport.Runways {
+			if runway.TailwindLimit > 0 && !runway.Preferred {
+				return nil, fmt.Errorf("runway %s of airport %s has a tailwind limit but is not preferred", runway.Name, iata)
+			}
+		}
+		if airport.Timezone != "" {
+			location, err := time.LoadLocation(airport.Timezone)
+			if err != nil {
+				return nil, fmt.Errorf("invalid timezone for airport %s: %v", iata, err)
+			}
+			config.locations[iata] = location
+		}
+	}
+
+	if config.DefaultTimezone != "" {
+		location, err := time.LoadLocation(config.DefaultTimezone)
+		if err != nil {
+			return nil, fmt.Errorf("invalid default timezone: %v", err)
+		}
+		config.locations[""] = location
+	}
+
+	return &config, nil
+}
+
+func (config *Config) Location(iata string) *time.Location {
+	if location, ok := config.locations[iata]; ok {
+		return location
+	}
+	if location, ok := config.locations[""]; ok {
+		return location
+	}
+	return time.UTC
+}
+
+func (config *Config) LocalTime(iata string, t time.Time) time.Time {
+	return t.In(config.Location(iata))
+}
+
+// Season returns the name of the first season of the airport calendar matching
+// the local date of t, or an empty string when no season matches.
+func (config *Config) Season(iata string, t time.Time) string {
+	calendar := config.DefaultCalendar
+	if airport, ok := config.Airports[iata]; ok && airport.Calendar != "" {
+		calendar = airport.Calendar
+	}
+
+	local := config.LocalTime(iata, t)
+	for _, season := range config.Calendars[calendar] {
+		if season.matches(local) {
+			return season.Name
+		}
+	}
+	return ""
+}
+
+func (season Season) matches(t time.Time) bool {
+	for _, month := range season.Months {
+		if time.Month(month) == t.Month() {
+			return true
+		}
+	}
+
+	day := t.YearDay()
+	for _, days := range season.Days {
+		if days.From <= days.To && day >= days.From && day <= days.To {
+			return true
+		}
+		// Ranges such as 335-59 wrap around the end of the year
+		if days.From > days.To && (day >= days.From || day <= days.To) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,110 @@
+package airports
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+const testConfig = `
+defaultTimezone: Europe/Paris
+defaultCalendar: northern
+calendars:
+  northern:
+    - name: summer
+      months: [3, 4, 5, 6, 7, 8, 9]
+    - name: winter
+      months: [10, 11, 12, 1, 2]
+  mediterranean:
+    - name: winter
+      days:
+        - from: 335
+          to: 59
+    - name: summer
+      days:
+        - from: 152
+          to: 273
+  partial:
+    - name: dry
+      months: [7]
+airports:
+  MRS:
+    calendar: mediterranean
+  NOU:
+    timezone: Pacific/Noumea
+  XXX:
+    calendar: partial
+`
+
+func loadTestConfig(t *testing.T) *Config {
+	filename := filepath.Join(t.TempDir(), "airport_config.yml")
+	err := os.WriteFile(filename, []byte(testConfig), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	config, err := LoadConfig(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return config
+}
+
+func TestSeason(t *testing.T) {
+	config := loadTestConfig(t)
+
+	tests := []struct {
+		name    string
+		airport string
+		time    time.Time
+		want    string
+	}{
+		{"month of the default calendar", "LYS", time.Date(2024, 7, 14, 12, 0, 0, 0, time.UTC), "summer"},
+		{"month after the year end", "LYS", time.Date(2024, 1, 19, 12, 0, 0, 0, time.UTC), "winter"},
+		{"local month after UTC midnight", "LYS", time.Date(2024, 9, 30, 23, 30, 0, 0, time.UTC), "winter"},
+		{"local month of another time zone", "NOU", time.Date(2024, 2, 29, 14, 0, 0, 0, time.UTC), "summer"},
+		{"first day of a wrapping range", "MRS", time.Date(2023, 12, 1, 12, 0, 0, 0, time.UTC), "winter"},
+		{"last day of the year in a wrapping range", "MRS", time.Date(2023, 12, 31, 12, 0, 0, 0, time.UTC), "winter"},
+		{"first day of the year in a wrapping range", "MRS", time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC), "winter"},
+		{"last day of a wrapping range", "MRS", time.Date(2023, 2, 28, 12, 0, 0, 0, time.UTC), "winter"},
+		// Day ranges count days of the year, day 60 is February 29 in a leap year
+		{"day after a wrapping range", "MRS", time.Date(2024, 2, 29, 12, 0, 0, 0, time.UTC), ""},
+		{"first day of a range", "MRS", time.Date(2023, 6, 1, 12, 0, 0, 0, time.UTC), "summer"},
+		{"last day of a range", "MRS", time.Date(2023, 9, 30, 12, 0, 0, 0, time.UTC), "summer"},
+		{"day between the ranges", "MRS", time.Date(2023, 10, 1, 12, 0, 0, 0, time.UTC), ""},
+		{"month out of a partial calendar", "XXX", time.Date(2024, 1, 19, 12, 0, 0, 0, time.UTC), ""},
+	}
+	for _, test := range tests {
+		if got := config.Season(test.airport, test.time); got != test.want {
+			t.Errorf("%s: Season(%s, %s) = %q, want %q", test.name, test.airport, test.time, got, test.want)
+		}
+	}
+}
+
+func TestLoadConfigRejectsUnknownCalendar(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "airport_config.yml")
+	err := os.WriteFile(filename, []byte(testConfig+"  ZZZ:\n    calendar: tropical\n"), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = LoadConfig(filename)
+	if err == nil {
+		t.Fatal("expected an error for an unknown calendar")
+	}
+}
+
+func TestLoadConfigRejectsTailwindLimitOfUnpreferredRunway(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "airport_config.yml")
+	runways := "  LYS:\n    runways:\n      - name: 17L\n        heading: 174\n        tailwindLimit: 5.0\n"
+	err := os.WriteFile(filename, []byte(testConfig+runways), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = LoadConfig(filename)
+	if err == nil {
+		t.Fatal("expected an error for the tailwind limit of a runway that is not preferred")
+	}
+}
@@ -0,0 +1,146 @@
+package alerts
+
+import (
+	"fmt"
+	"github.com/google/uuid"
+	"time"
+)
+
+const (
+	SeverityInfo     = "info"
+	SeverityWarning  = "warning"
+	SeverityCritical = "critical"
+)
+
+const (
+	StatusFiring   = "firing"
+	StatusResolved = "resolved"
+)
+
+const (
+	IncidentOpen     = "open"
+	IncidentResolved = "resolved"
+)
+
+type Alert struct {
+	ID              string           `json:"id"`
+	Airport         string           `json:"airport"`
+	Measurement     string           `json:"measurement"`
+	Rule            string           `json:"rule"`
+	Severity        string           `json:"severity"`
+	Status          string           `json:"status"`
+	Value           float64          `json:"value"`
+	Message         string           `json:"message"`
+	Time            time.Time        `json:"time"`
+	StartsAt        time.Time        `json:"startsAt"`
+	EndsAt          *time.Time       `json:"endsAt,omitempty"`
+	Silenced        bool             `json:"silenced"`
+	Acknowledgement *Acknowledgement `json:"acknowledgement,omitempty"`
+	IncidentID      string           `json:"incidentId,omitempty"`
+	// NotifiedAt is when the alert manager notified the alert after raising it, the end
+	// of its silence or the loss of its acknowledgement. StartsAt is a sensor time.
+	NotifiedAt time.Time `json:"notifiedAt"`
+}
+
+// An Incident groups the alerts of an airport raised close to each other in time.
+type Incident struct {
+	ID       string          `json:"id"`
+	Airport  string          `json:"airport"`
+	Status   string          `json:"status"`
+	Severity string          `json:"severity"`
+	StartsAt time.Time       `json:"startsAt"`
+	EndsAt   *time.Time      `json:"endsAt,omitempty"`
+	Timeline []IncidentEvent `json:"timeline"`
+}
+
+// IncidentEvent records a member alert firing, escalating or resolving.
+type IncidentEvent struct {
+	Time        time.Time `json:"time"`
+	AlertID     string    `json:"alertId"`
+	Measurement string    `json:"measurement"`
+	Rule        string    `json:"rule"`
+	Severity    string    `json:"severity"`
+	Status      string    `json:"status"`
+	Message     string    `json:"message"`
+}
+
+type Acknowledgement struct {
+	AlertID string    `json:"alertId"`
+	By      string    `json:"by"`
+	Comment string    `json:"comment"`
+	At      time.Time `json:"at"`
+}
+
+// A Silence suppresses the notifications of the alerts it matches between StartsAt and EndsAt.
+// Empty Airport, Measurement or Rule fields match any value.
+type Silence struct {
+	ID          string    `json:"id" yaml:"id"`
+	Airport     string    `json:"airport" yaml:"airport"`
+	Measurement string    `json:"measurement" yaml:"measurement"`
+	Rule        string    `json:"rule" yaml:"rule"`
+	StartsAt    time.Time `json:"startsAt" yaml:"startsAt"`
+	EndsAt      time.Time `json:"endsAt" yaml:"endsAt"`
+	CreatedBy   string    `json:"createdBy" yaml:"createdBy"`
+	Comment     string    `json:"comment" yaml:"comment"`
+}
+
+// State is the snapshot of the alert manager published on the state topic.
+type State struct {
+	Silences []Silence `json:"silences"`
+	// Active holds every firing alert, including those that left the capped history
+	Active    []Alert    `json:"active"`
+	History   []Alert    `json:"history"`
+	Incidents []Incident `json:"incidents"`
+	// PublishFailures counts the messages the alert manager failed to publish since it started
+	PublishFailures int64 `json:"publishFailures"`
+}
+
+func NewID() string {
+	return uuid.NewString()
+}
+
+// Key identifies the rule of an airport an alert is raised for, it stays the same
+// across successive alerts while the ID changes each time the alert fires again.
+func (alert Alert) Key() string {
+	return alert.Airport + "/" + alert.Measurement + "/" + alert.Rule
+}
+
+func SeverityRank(severity string) int {
+	switch severity {
+	case SeverityInfo:
+		return 1
+	case SeverityWarning:
+		return 2
+	case SeverityCritical:
+		return 3
+	default:
+		return 0
+	}
+}
+
+func (ack Acknowledgement) Validate() error {
+	if ack.AlertID == "" || ack.By == "" {
+		return fmt.Errorf("acknowledgement needs an alert ID and a user")
+	}
+	return nil
+}
+
+func (silence Silence) Validate() error {
+	if silence.StartsAt.IsZero() || silence.EndsAt.IsZero() {
+		return fmt.Errorf("silence needs a start and an end time")
+	}
+	if !silence.EndsAt.After(silence.StartsAt) {
+		return fmt.Errorf("silence must end after it starts")
+	}
+	return nil
+}
+
+func (silence Silence) ActiveAt(t time.Time) bool {
+	return !t.Before(silence.StartsAt) && t.Before(silence.EndsAt)
+}
+
+func (silence Silence) Matches(alert Alert) bool {
+	return (silence.Airport == "" || silence.Airport == alert.Airport) &&
+		(silence.Measurement == "" || silence.Measurement == alert.Measurement) &&
+		(silence.Rule == "" || silence.Rule == alert.Rule)
+}
@@ -7,6 +7,7 @@ import (
 	"os"
 	"path/filepath"
 	"runtime"
+	"time"
 )
 
 type Config struct {
@@ -15,18 +16,108 @@ type Config struct {
 		AlertManager struct {
 			Subscribe string `yaml:"subscribe"`
 			Publish   string `yaml:"publish"`
+			Commands  string `yaml:"commands"`
+			State     string `yaml:"state"`
+			Runways   string `yaml:"runways"`
+			Leader    string `yaml:"leader"`
 		} `yaml:"alertManager"`
 	} `yaml:"topics"`
+	AlertManager struct {
+		Workers        int `yaml:"workers"`
+		QueueSize      int `yaml:"queueSize"`
+		LeaderElection struct {
+			LeaseDuration     time.Duration `yaml:"leaseDuration"`
+			HeartbeatInterval time.Duration `yaml:"heartbeatInterval"`
+		} `yaml:"leaderElection"`
+	} `yaml:"alertManager"`
 	InfluxDB struct {
 		Bucket    string `yaml:"bucket"`
 		Org       string `yaml:"org"`
 		Url       string `yaml:"url"`
 		Subscribe string `yaml:"subscribe"`
 	} `yaml:"influxdb"`
-	FileRecorder struct {
-		Subscribe     string `yaml:"subscribe"`
-		RecordingPath string `yaml:"recordingPath"`
-	} `yaml:"fileRecorder"`
+	FileRecorder FileRecorderConfig `yaml:"fileRecorder"`
+}
+
+type FileRecorderConfig struct {
+	Subscribe     string `yaml:"subscribe"`
+	RecordingPath string `yaml:"recordingPath"`
+	Format        string `yaml:"format"`
+	// Path of the daily files under RecordingPath, see recordings.NewLayout
+	PathTemplate   string `yaml:"pathTemplate"`
+	HivePartitions bool   `yaml:"hivePartitions"`
+	// Buffered files are flushed and synced every FlushInterval or FlushEvery records
+	FlushInterval time.Duration `yaml:"flushInterval"`
+	FlushEvery    int           `yaml:"flushEvery"`
+	// Compression of the files of the past days: none, gzip or zstd
+	Compression string `yaml:"compression"`
+	// RotateSize starts a new part of a daily file above this size in bytes, 0 disables it
+	RotateSize int64 `yaml:"rotateSize"`
+	// Files older than Retention are deleted, or moved to ArchivePath when it is set
+	Retention   time.Duration `yaml:"retention"`
+	ArchivePath string        `yaml:"archivePath"`
+	// Alerts of AlertSubscribe are logged per airport and day in AlertPath
+	AlertSubscribe string `yaml:"alertSubscribe"`
+	AlertPath      string `yaml:"alertPath"`
+	// Records are spooled to FallbackPath while RecordingPath is unwritable, which is
+	// retried after RetryBackoff, doubled on each failure up to MaxRetryBackoff
+	FallbackPath    string        `yaml:"fallbackPath"`
+	RetryBackoff    time.Duration `yaml:"retryBackoff"`
+	MaxRetryBackoff time.Duration `yaml:"maxRetryBackoff"`
+	// The recorder health is published on HealthTopic/<client ID>
+	HealthTopic string `yaml:"healthTopic"`
+	// Named recorder instances, their settings replace the ones above
+	Instances map[string]FileRecorderConfig `yaml:"instances,omitempty"`
+}
+
+// Instance returns the settings of a named recorder instance.
+func (c FileRecorderConfig) Instance(name string) (FileRecorderConfig, bool) {
+	instance, ok := c.Instances[name]
+	if !ok {
+		return c, false
+	}
+
+	config := c
+	config.Instances = nil
+	// A single recorder logs the alerts unless an instance asks for it
+	config.AlertSubscribe = instance.AlertSubscribe
+	if instance.AlertPath != "" {
+		config.AlertPath = instance.AlertPath
+	}
+	// The spool of a recorder follows its format and layout
+	config.FallbackPath = instance.FallbackPath
+	if instance.Subscribe != "" {
+		config.Subscribe = instance.Subscribe
+	}
+	if instance.RecordingPath != "" {
+		config.RecordingPath = instance.RecordingPath
+	}
+	if instance.Format != "" {
+		config.Format = instance.Format
+	}
+	if instance.PathTemplate != "" {
+		config.PathTemplate = instance.PathTemplate
+		config.HivePartitions = instance.HivePartitions
+	}
+	if instance.Compression != "" {
+		config.Compression = instance.Compression
+	}
+	if instance.RotateSize != 0 {
+		config.RotateSize = instance.RotateSize
+	}
+	if instance.Retention != 0 {
+		config.Retention = instance.Retention
+	}
+	if instance.ArchivePath != "" {
+		config.ArchivePath = instance.ArchivePath
+	}
+	if instance.RetryBackoff != 0 {
+		config.RetryBackoff = instance.RetryBackoff
+	}
+	if instance.MaxRetryBackoff != 0 {
+		config.MaxRetryBackoff = instance.MaxRetryBackoff
+	}
+	return config, true
 }
 
 func getAppConfig() (Config, error) {
@@ -75,12 +166,68 @@ func GetAlertManagerTopics() []string {
 
 	alertManagerTopicSubscribe := config.Topics.AlertManager.Subscribe
 	alertManagerTopicPublish := config.Topics.AlertManager.Publish
+	alertManagerTopicCommands := config.Topics.AlertManager.Commands
+	alertManagerTopicState := config.Topics.AlertManager.State
+	alertManagerTopicRunways := config.Topics.AlertManager.Runways
+	alertManagerTopicLeader := config.Topics.AlertManager.Leader
 
-	alertManagerTopics := []string{alertManagerTopicSubscribe, alertManagerTopicPublish}
+	alertManagerTopics := []string{alertManagerTopicSubscribe, alertManagerTopicPublish, alertManagerTopicCommands, alertManagerTopicState, alertManagerTopicRunways, alertManagerTopicLeader}
 
 	return alertManagerTopics
 }
 
+// GetAlertManagerStateTopic returns the topic of the state published by the alert manager.
+func GetAlertManagerStateTopic() string {
+	config, err := getAppConfig()
+	if err != nil {
+		log.Fatalf("Error getting app config: %v", err)
+		return ""
+	}
+
+	return config.Topics.AlertManager.State
+}
+
+// GetAlertManagerLeaderTopic returns the topic of the leader lease of the alert managers.
+func GetAlertManagerLeaderTopic() string {
+	config, err := getAppConfig()
+	if err != nil {
+		log.Fatalf("Error getting app config: %v", err)
+		return ""
+	}
+
+	return config.Topics.AlertManager.Leader
+}
+
+func GetAlertManagerSettings() []int {
+	config, err := getAppConfig()
+	if err != nil {
+		log.Fatalf("Error getting app config: %v", err)
+		return []int{}
+	}
+
+	alertManagerWorkers := config.AlertManager.Workers
+	alertManagerQueueSize := config.AlertManager.QueueSize
+
+	alertManagerSettings := []int{alertManagerWorkers, alertManagerQueueSize}
+
+	return alertManagerSettings
+}
+
+func GetLeaderElectionSettings() []time.Duration {
+	config, err := getAppConfig()
+	if err != nil {
+		log.Fatalf("Error getting app config: %v", err)
+		return []time.Duration{}
+	}
+
+	leaseDuration := config.AlertManager.LeaderElection.LeaseDuration
+	heartbeatInterval := config.AlertManager.LeaderElection.HeartbeatInterval
+
+	leaderElectionSettings := []time.Duration{leaseDuration, heartbeatInterval}
+
+	return leaderElectionSettings
+}
+
 func GetInfluxdbSettings() []string {
 	config, err := getAppConfig()
 	if err != nil {
@@ -98,6 +245,16 @@ func GetInfluxdbSettings() []string {
 	return databaseRecorderConfig
 }
 
+func GetFileRecorderConfig() FileRecorderConfig {
+	config, err := getAppConfig()
+	if err != nil {
+		log.Fatalf("Error getting app config: %v", err)
+		return FileRecorderConfig{}
+	}
+
+	return config.FileRecorder
+}
+
 func GetFileRecorderSettings() []string {
 	config, err := getAppConfig()
 	if err != nil {
@@ -107,8 +264,9 @@ func GetFileRecorderSettings() []string {
 
 	fileRecorderTopic := config.FileRecorder.Subscribe
 	fileRecorderFolder := config.FileRecorder.RecordingPath
+	fileRecorderFormat := config.FileRecorder.Format
 
-	fileRecorderConfig := []string{fileRecorderTopic, fileRecorderFolder}
+	fileRecorderConfig := []string{fileRecorderTopic, fileRecorderFolder, fileRecorderFormat}
 
 	return fileRecorderConfig
 }
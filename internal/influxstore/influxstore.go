@@ -0,0 +1,149 @@
+package influxstore
+
+import (
+	brokerconfiguration "ArchiD-Projet/internal/brokerConfiguration"
+	"context"
+	"fmt"
+	influxdb2 "github.com/influxdata/influxdb-client-go/v2"
+	"github.com/influxdata/influxdb-client-go/v2/api/write"
+	"os"
+	"slices"
+	"strings"
+	"time"
+)
+
+// A Point is a reading as the databaserecorder stores it: the measurement is the sensor,
+// with an airport tag and a value field.
+type Point struct {
+	Airport     string
+	Measurement string
+	Time        time.Time
+	Value       float64
+}
+
+// A Key identifies a point of an airport.
+type Key struct {
+	Measurement string
+	Time        int64
+}
+
+func (p Point) Key() Key {
+	return Key{p.Measurement, p.Time.UnixNano()}
+}
+
+// A Store reads and writes the points of the databaserecorder.
+type Store interface {
+	// Query returns the points in [from, to) of the airports and measurements, all of
+	// them when empty
+	Query(from time.Time, to time.Time, airports []string, measurements []string) ([]Point, error)
+	Write(points []Point) error
+}
+
+// Client is the Store of the InfluxDB bucket of the databaserecorder.
+type Client struct {
+	client influxdb2.Client
+	bucket string
+	org    string
+}
+
+// NewClient connects to the InfluxDB of the app config with the INFLUX_DB_API_KEY
+// environment variable.
+func NewClient() (*Client, error) {
+	apiKey := os.Getenv("INFLUX_DB_API_KEY")
+	if apiKey == "" {
+		return nil, fmt.Errorf("INFLUX_DB_API_KEY environment variable not set")
+	}
+
+	config := brokerconfiguration.GetInfluxdbSettings()
+	return &Client{client: influxdb2.NewClient(config[2], apiKey), bucket: config[0], org: config[1]}, nil
+}
+
+func (c *Client) Close() {
+	c.client.Close()
+}
+
+func (c *Client) Query(from time.Time, to time.Time, airports []string, measurements []string) ([]Point, error) {
+	result, err := c.client.QueryAPI(c.org).Query(context.Background(), fluxQuery(c.bucket, from, to, airports, measurements))
+	if err != nil {
+		return nil, err
+	}
+	defer result.Close()
+
+	var points []Point
+	for result.Next() {
+		airport, ok1 := result.Record().ValueByKey("airport").(string)
+		value, ok2 := result.Record().Value().(float64)
+		if !ok1 || !ok2 {
+			continue
+		}
+		points = append(points, Point{Airport: airport, Measurement: result.Record().Measurement(), Time: result.Record().Time(), Value: value})
+	}
+	return points, result.Err()
+}
+
+func fluxQuery(bucket string, from time.Time, to time.Time, airports []string, measurements []string) string {
+	query := fmt.Sprintf(`
+        from(bucket: "%s")
+  			|> range(start: %s, stop: %s)
+  			|> filter(fn: (r) => r["_field"] == "value")`,
+		bucket, from.Format(time.RFC3339), to.Format(time.RFC3339))
+	query += filter("_measurement", measurements)
+	query += filter("airport", airports)
+	return query + `
+  			|> keep(columns: ["_time", "_measurement", "_value", "airport"])`
+}
+
+func filter(column string, values []string) string {
+	if len(values) == 0 {
+		return ""
+	}
+	var conditions []string
+	for _, value := range values {
+		conditions = append(conditions, fmt.Sprintf(`r["%s"] == "%s"`, column, value))
+	}
+	return fmt.Sprintf(`
+  			|> filter(fn: (r) => %s)`, strings.Join(conditions, " or "))
+}
+
+func (c *Client) Write(points []Point) error {
+	influxPoints := make([]*write.Point, len(points))
+	for i, point := range points {
+		influxPoints[i] = influxdb2.NewPointWithMeasurement(point.Measurement).
+			AddTag("airport", point.Airport).
+			AddField("value", point.Value).
+			SetTime(point.Time)
+	}
+	return c.client.WriteAPIBlocking(c.org, c.bucket).WritePoint(context.Background(), influxPoints...)
+}
+
+// Memory is a Store keeping its points in memory, for the tests of the commands.
+type Memory struct {
+	Points []Point
+	// Points of each Write
+	Batches [][]Point
+	Queries int
+}
+
+func (m *Memory) Query(from time.Time, to time.Time, airports []string, measurements []string) ([]Point, error) {
+	m.Queries++
+	var points []Point
+	for _, point := range m.Points {
+		if point.Time.Before(from) || !point.Time.Before(to) {
+			continue
+		}
+		if len(airports) > 0 && !slices.Contains(airports, point.Airport) {
+			continue
+		}
+		if len(measurements) > 0 && !slices.Contains(measurements, point.Measurement) {
+			continue
+		}
+		points = append(points, point)
+	}
+	return points, nil
+}
+
+func (m *Memory) Write(points []Point) error {
+	m.Batches = append(m.Batches, points)
+	m.Points = append(m.Points, points...)
+	return nil
+}
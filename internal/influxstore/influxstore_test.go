@@ -0,0 +1,44 @@
+package influxstore
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestFluxQuery(t *testing.T) {
+	from := time.Date(2024, 1, 19, 0, 0, 0, 0, time.UTC)
+	query := fluxQuery("airports", from, from.AddDate(0, 0, 1), []string{"MRS", "LYS"}, []string{"wind"})
+	for _, expected := range []string{
+		`from(bucket: "airports")`,
+		`range(start: 2024-01-19T00:00:00Z, stop: 2024-01-20T00:00:00Z)`,
+		`filter(fn: (r) => r["_measurement"] == "wind")`,
+		`filter(fn: (r) => r["airport"] == "MRS" or r["airport"] == "LYS")`,
+	} {
+		if !strings.Contains(query, expected) {
+			t.Errorf("query without %s:\n%s", expected, query)
+		}
+	}
+	if query := fluxQuery("airports", from, from, nil, nil); strings.Contains(query, "airport\"] ==") || strings.Contains(query, "_measurement\"] ==") {
+		t.Errorf("query filtering all the airports and measurements:\n%s", query)
+	}
+}
+
+func TestMemoryQuery(t *testing.T) {
+	from := time.Date(2024, 1, 19, 0, 0, 0, 0, time.UTC)
+	store := &Memory{}
+	store.Write([]Point{
+		{Airport: "MRS", Measurement: "wind", Time: from, Value: 8},
+		{Airport: "LYS", Measurement: "wind", Time: from, Value: 3},
+		{Airport: "MRS", Measurement: "pressure", Time: from, Value: 1013},
+		{Airport: "MRS", Measurement: "wind", Time: from.AddDate(0, 0, 1), Value: 9},
+	})
+
+	points, _ := store.Query(from, from.AddDate(0, 0, 1), []string{"MRS"}, []string{"wind"})
+	if len(points) != 1 || points[0].Value != 8 {
+		t.Errorf("unexpected points %+v", points)
+	}
+	if points[0].Key() != (Key{"wind", from.UnixNano()}) {
+		t.Errorf("unexpected key %+v", points[0].Key())
+	}
+}
@@ -21,7 +21,9 @@ type APIResponse struct {
 	ValidityTime  time.Time `json:"validity_time"`
 	T             float64   `json:"t"`
 	Ff            float64   `json:"ff"`
+	Dd            float64   `json:"dd"`
 	Pres          float64   `json:"pres"`
+	U             float64   `json:"u"`
 }
 
 type SensorData struct {
@@ -40,10 +42,12 @@ type SensorInfo struct {
 	GeoIDInsee            string        `yaml:"geoIDInsee"`
 }
 
+// The API key can also come from the environment, so a missing .env file is not fatal
+// for the programs that only use the sensor configuration.
 func init() {
 	err := godotenv.Load()
 	if err != nil {
-		log.Fatal("Error loading .env file:", err)
+		log.Println("No .env file loaded:", err)
 	}
 }
 
@@ -117,6 +121,22 @@ func FetchSensorDataFromAPI(sensorInfo SensorInfo) (SensorData, error) {
 			MeasurementValue: apiResponse.Ff,
 			MeasurementTime:  referenceTimeUTC1,
 		}
+	case strings.HasPrefix(sensorInfo.ClientID, "wind_direction_sensor"):
+		sensorData = SensorData{
+			SensorID:         1,
+			AirportID:        sensorInfo.AirportIATA,
+			Measurement:      "wind_direction",
+			MeasurementValue: apiResponse.Dd,
+			MeasurementTime:  referenceTimeUTC1,
+		}
+	case strings.HasPrefix(sensorInfo.ClientID, "humidity_sensor"):
+		sensorData = SensorData{
+			SensorID:         1,
+			AirportID:        sensorInfo.AirportIATA,
+			Measurement:      "humidity",
+			MeasurementValue: apiResponse.U,
+			MeasurementTime:  referenceTimeUTC1,
+		}
 	default:
 		return SensorData{}, fmt.Errorf("unknown measurement type: %s", sensorInfo.ClientID)
 	}
@@ -33,6 +33,17 @@ func (m *Client) Publish(topic string, qos byte, retained bool, payload interfac
 	return token.Error()
 }
 
+// PublishAsync publishes without waiting for the broker, delivery errors are passed to onError.
+func (m *Client) PublishAsync(topic string, qos byte, retained bool, payload interface{}, onError func(error)) {
+	token := m.client.Publish(topic, qos, retained, payload)
+	go func() {
+		<-token.Done()
+		if token.Error() != nil && onError != nil {
+			onError(token.Error())
+		}
+	}()
+}
+
 func (m *Client) Subscribe(topic string, qos byte, callback mqtt.MessageHandler) error {
 	if token := m.client.Subscribe(topic, qos, callback); token.Wait() && token.Error() != nil {
 		return token.Error()
@@ -0,0 +1,160 @@
+package notifications
+
+import (
+	"ArchiD-Projet/internal/alerts"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// OnCallTarget is the escalation target replaced by the sink on call at the airport.
+const OnCallTarget = "oncall"
+
+const defaultRotationPeriod = 7 * 24 * time.Hour
+
+// An EscalationPolicy notifies more targets while a matching alert stays firing and
+// unacknowledged. Steps are sent in addition to the regular sink routing.
+type EscalationPolicy struct {
+	Name   string           `yaml:"name"`
+	Match  Match            `yaml:"match"`
+	Steps  []EscalationStep `yaml:"steps"`
+	Repeat RepeatRule       `yaml:"repeat"`
+}
+
+type EscalationStep struct {
+	// After is the delay since the alert was notified
+	After   time.Duration `yaml:"after"`
+	Targets []string      `yaml:"targets"`
+}
+
+// RepeatRule sends the last step again every Interval, at most Times times.
+type RepeatRule struct {
+	Interval time.Duration `yaml:"interval"`
+	Times    int           `yaml:"times"`
+}
+
+// An OnCallSchedule rotates the on-call sink of an airport, the first sink of the
+// rotation is on call from Start and hands over every Period (one week by default).
+type OnCallSchedule struct {
+	Start    time.Time     `yaml:"start"`
+	Period   time.Duration `yaml:"period"`
+	Rotation []string      `yaml:"rotation"`
+}
+
+func (schedule OnCallSchedule) At(t time.Time) (string, bool) {
+	if len(schedule.Rotation) == 0 || t.Before(schedule.Start) {
+		return "", false
+	}
+
+	period := schedule.Period
+	if period == 0 {
+		period = defaultRotationPeriod
+	}
+	turn := int(t.Sub(schedule.Start) / period)
+	return schedule.Rotation[turn%len(schedule.Rotation)], true
+}
+
+// Next returns the step of the notification number sent of an alert, starting at 0,
+// and its delay since the alert started firing. ok is false once the policy is exhausted.
+func (policy EscalationPolicy) Next(sent int) (step EscalationStep, after time.Duration, ok bool) {
+	if sent < len(policy.Steps) {
+		return policy.Steps[sent], policy.Steps[sent].After, true
+	}
+
+	repeat := sent - len(policy.Steps) + 1
+	if len(policy.Steps) == 0 || policy.Repeat.Interval == 0 || repeat > policy.Repeat.Times {
+		return EscalationStep{}, 0, false
+	}
+	last := policy.Steps[len(policy.Steps)-1]
+	return last, last.After + time.Duration(repeat)*policy.Repeat.Interval, true
+}
+
+func (config Config) validateEscalations() error {
+	sinks := make(map[string]bool)
+	for _, sink := range config.Sinks {
+		sinks[sink.Name] = true
+	}
+
+	for _, policy := range config.Escalations {
+		if len(policy.Steps) == 0 {
+			return fmt.Errorf("escalation %s has no steps", policy.Name)
+		}
+		for i, step := range policy.Steps {
+			if i > 0 && step.After < policy.Steps[i-1].After {
+				return fmt.Errorf("escalation %s: steps must be ordered by delay", policy.Name)
+			}
+			for _, target := range step.Targets {
+				if target != OnCallTarget && !sinks[target] {
+					return fmt.Errorf("escalation %s: unknown sink %s", policy.Name, target)
+				}
+			}
+		}
+	}
+
+	for airport, schedule := range config.OnCall {
+		for _, sink := range schedule.Rotation {
+			if !sinks[sink] {
+				return fmt.Errorf("on-call schedule of %s: unknown sink %s", airport, sink)
+			}
+		}
+	}
+	return nil
+}
+
+// Escalation returns the first escalation policy matching an alert.
+func (dispatcher *Dispatcher) Escalation(alert alerts.Alert) (EscalationPolicy, bool) {
+	for _, policy := range dispatcher.escalations {
+		if policy.Match.matches(alert) {
+			return policy, true
+		}
+	}
+	return EscalationPolicy{}, false
+}
+
+func (dispatcher *Dispatcher) OnCall(airport string, t time.Time) (string, bool) {
+	schedule, ok := dispatcher.onCall[airport]
+	if !ok {
+		return "", false
+	}
+	return schedule.At(t)
+}
+
+// NotifyTargets sends an alert to the named sinks, whatever their match, the on-call
+// target being resolved at time now.
+func (dispatcher *Dispatcher) NotifyTargets(alert alerts.Alert, targets []string, now time.Time) error {
+	names := make(map[string]bool)
+	var errs []error
+	for _, target := range targets {
+		if target == OnCallTarget {
+			onCall, ok := dispatcher.OnCall(alert.Airport, now)
+			if !ok {
+				errs = append(errs, fmt.Errorf("nobody on call at %s", alert.Airport))
+				continue
+			}
+			target = onCall
+		}
+		names[target] = true
+	}
+
+	var waitGroup sync.WaitGroup
+	routeErrs := make([]error, len(dispatcher.routes))
+	for i, r := range dispatcher.routes {
+		if !names[r.config.Name] {
+			continue
+		}
+		delete(names, r.config.Name)
+
+		waitGroup.Add(1)
+		go func(i int, r route) {
+			defer waitGroup.Done()
+			routeErrs[i] = r.deliver(alert)
+		}(i, r)
+	}
+	waitGroup.Wait()
+
+	for name := range names {
+		errs = append(errs, fmt.Errorf("unknown sink: %s", name))
+	}
+	return errors.Join(append(errs, routeErrs...)...)
+}
@@ -0,0 +1,210 @@
+package notifications
+
+import (
+	"ArchiD-Projet/internal/alerts"
+	"bytes"
+	"errors"
+	"fmt"
+	"gopkg.in/yaml.v3"
+	"log"
+	"os"
+	"sync"
+	"text/template"
+	"time"
+)
+
+const defaultTemplate = "[{{.Severity}}] {{.Airport}} {{.Measurement}}: {{.Message}}"
+
+type Config struct {
+	Sinks []SinkConfig `yaml:"sinks"`
+	// RepeatInterval is the delay after which a firing alert is notified again, 0 only
+	// notifies its changes
+	RepeatInterval time.Duration             `yaml:"repeatInterval"`
+	Escalations    []EscalationPolicy        `yaml:"escalations"`
+	OnCall         map[string]OnCallSchedule `yaml:"onCall"`
+}
+
+type SinkConfig struct {
+	Name       string            `yaml:"name"`
+	Type       string            `yaml:"type"`
+	URL        string            `yaml:"url"`
+	Headers    map[string]string `yaml:"headers"`
+	SMTP       SMTPConfig        `yaml:"smtp"`
+	Subject    string            `yaml:"subject"`
+	Template   string            `yaml:"template"`
+	Retries    int               `yaml:"retries"`
+	RetryDelay time.Duration     `yaml:"retryDelay"`
+	Match      Match             `yaml:"match"`
+	// An escalation only sink is only used as an escalation or on-call target
+	EscalationOnly bool `yaml:"escalationOnly"`
+}
+
+type SMTPConfig struct {
+	Host        string   `yaml:"host"`
+	Port        int      `yaml:"port"`
+	Username    string   `yaml:"username"`
+	PasswordEnv string   `yaml:"passwordEnv"`
+	From        string   `yaml:"from"`
+	To          []string `yaml:"to"`
+}
+
+type Match struct {
+	Airports   []string `yaml:"airports"`
+	Severities []string `yaml:"severities"`
+	Rules      []string `yaml:"rules"`
+}
+
+type Sink interface {
+	Send(alert alerts.Alert, message string) error
+}
+
+type route struct {
+	config   SinkConfig
+	sink     Sink
+	template *template.Template
+}
+
+type Dispatcher struct {
+	routes      []route
+	escalations []EscalationPolicy
+	onCall      map[string]OnCallSchedule
+}
+
+func LoadConfig(filename string) (Config, error) {
+	var config Config
+
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		return config, err
+	}
+
+	err = yaml.Unmarshal(data, &config)
+	if err != nil {
+		return config, err
+	}
+
+	return config, nil
+}
+
+func NewDispatcher(config Config) (*Dispatcher, error) {
+	err := config.validateEscalations()
+	if err != nil {
+		return nil, err
+	}
+
+	dispatcher := &Dispatcher{escalations: config.Escalations, onCall: config.OnCall}
+
+	for _, sinkConfig := range config.Sinks {
+		sink, err := newSink(sinkConfig)
+		if err != nil {
+			return nil, fmt.Errorf("sink %s: %v", sinkConfig.Name, err)
+		}
+
+		text := sinkConfig.Template
+		if text == "" {
+			text = defaultTemplate
+		}
+		tmpl, err := template.New(sinkConfig.Name).Parse(text)
+		if err != nil {
+			return nil, fmt.Errorf("sink %s: error parsing template: %v", sinkConfig.Name, err)
+		}
+
+		dispatcher.routes = append(dispatcher.routes, route{config: sinkConfig, sink: sink, template: tmpl})
+	}
+
+	return dispatcher, nil
+}
+
+func newSink(config SinkConfig) (Sink, error) {
+	switch config.Type {
+	case "webhook":
+		return newWebhookSink(config)
+	case "slack":
+		return newChatSink(config, slackPayload)
+	case "teams":
+		return newChatSink(config, teamsPayload)
+	case "email":
+		return newEmailSink(config)
+	default:
+		return nil, fmt.Errorf("unknown sink type: %s", config.Type)
+	}
+}
+
+func (match Match) matches(alert alerts.Alert) bool {
+	return contains(match.Airports, alert.Airport) && contains(match.Severities, alert.Severity) && contains(match.Rules, alert.Rule)
+}
+
+func (match Match) matchesAny(members []alerts.Alert) bool {
+	for _, alert := range members {
+		if match.matches(alert) {
+			return true
+		}
+	}
+	return false
+}
+
+// An empty list matches every value.
+func contains(list []string, value string) bool {
+	if len(list) == 0 {
+		return true
+	}
+	for _, item := range list {
+		if item == value {
+			return true
+		}
+	}
+	return false
+}
+
+func (dispatcher *Dispatcher) Notify(alert alerts.Alert) error {
+	return dispatcher.NotifyGroup(alert, []alerts.Alert{alert})
+}
+
+// NotifyGroup sends a notification standing for several alerts, such as an incident,
+// to the sinks matching at least one of the member alerts.
+func (dispatcher *Dispatcher) NotifyGroup(alert alerts.Alert, members []alerts.Alert) error {
+	var waitGroup sync.WaitGroup
+	errs := make([]error, len(dispatcher.routes))
+
+	for i, r := range dispatcher.routes {
+		if r.config.EscalationOnly || !r.config.Match.matchesAny(members) {
+			continue
+		}
+
+		waitGroup.Add(1)
+		go func(i int, r route) {
+			defer waitGroup.Done()
+			errs[i] = r.deliver(alert)
+		}(i, r)
+	}
+
+	waitGroup.Wait()
+	return errors.Join(errs...)
+}
+
+func (r route) deliver(alert alerts.Alert) error {
+	var buffer bytes.Buffer
+	err := r.template.Execute(&buffer, alert)
+	if err != nil {
+		return fmt.Errorf("sink %s: error rendering template: %v", r.config.Name, err)
+	}
+
+	delay := r.config.RetryDelay
+	if delay == 0 {
+		delay = time.Second
+	}
+
+	for attempt := 0; ; attempt++ {
+		err = r.sink.Send(alert, buffer.String())
+		if err == nil {
+			return nil
+		}
+		if attempt >= r.config.Retries {
+			return fmt.Errorf("sink %s: giving up after %d attempts: %v", r.config.Name, attempt+1, err)
+		}
+
+		log.Printf("Sink %s failed (attempt %d): %v\n", r.config.Name, attempt+1, err)
+		time.Sleep(delay)
+		delay *= 2
+	}
+}
@@ -0,0 +1,282 @@
+package notifications
+
+import (
+	"ArchiD-Projet/internal/alerts"
+	"bufio"
+	"encoding/json"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+var testAlert = alerts.Alert{
+	Airport:     "MRS",
+	Measurement: "wind",
+	Rule:        "wind",
+	Severity:    alerts.SeverityCritical,
+	Value:       72,
+	Message:     "Alert: Wind (72.000000) exceeded threshold (60.000000)",
+	Time:        time.Date(2024, 1, 19, 10, 0, 0, 0, time.UTC),
+}
+
+func TestWebhookSink(t *testing.T) {
+	var received webhookPayload
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("X-Token") != "secret" {
+			t.Errorf("missing custom header")
+		}
+		err := json.NewDecoder(r.Body).Decode(&received)
+		if err != nil {
+			t.Errorf("error decoding payload: %v", err)
+		}
+	}))
+	defer server.Close()
+
+	dispatcher, err := NewDispatcher(Config{Sinks: []SinkConfig{{
+		Name:     "hook",
+		Type:     "webhook",
+		URL:      server.URL,
+		Headers:  map[string]string{"X-Token": "secret"},
+		Template: "{{.Airport}} {{.Value}}",
+	}}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = dispatcher.Notify(testAlert)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if received.Text != "MRS 72" || received.Airport != "MRS" || received.Severity != alerts.SeverityCritical {
+		t.Errorf("unexpected payload: %+v", received)
+	}
+}
+
+func TestSinkRetries(t *testing.T) {
+	var calls int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(&calls, 1) < 3 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+	}))
+	defer server.Close()
+
+	dispatcher, err := NewDispatcher(Config{Sinks: []SinkConfig{
+		{Name: "slack", Type: "slack", URL: server.URL, Retries: 2, RetryDelay: time.Millisecond},
+	}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = dispatcher.Notify(testAlert)
+	if err != nil {
+		t.Errorf("expected delivery after retries, got %v", err)
+	}
+	if calls != 3 {
+		t.Errorf("expected 3 attempts, got %d", calls)
+	}
+}
+
+func TestSinkRouting(t *testing.T) {
+	var calls int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&calls, 1)
+	}))
+	defer server.Close()
+
+	dispatcher, err := NewDispatcher(Config{Sinks: []SinkConfig{
+		{Name: "lys", Type: "teams", URL: server.URL, Match: Match{Airports: []string{"LYS"}}},
+		{Name: "warnings", Type: "teams", URL: server.URL, Match: Match{Severities: []string{alerts.SeverityWarning}}},
+		{Name: "mrs-critical", Type: "teams", URL: server.URL, Match: Match{Airports: []string{"MRS"}, Severities: []string{alerts.SeverityCritical}}},
+	}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = dispatcher.Notify(testAlert)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if calls != 1 {
+		t.Errorf("expected only the matching sink to be called, got %d calls", calls)
+	}
+}
+
+func TestGroupRouting(t *testing.T) {
+	var calls sync.Map
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls.Store(r.URL.Path, true)
+	}))
+	defer server.Close()
+
+	dispatcher, err := NewDispatcher(Config{Sinks: []SinkConfig{
+		{Name: "wind", Type: "webhook", URL: server.URL + "/wind", Match: Match{Rules: []string{"wind"}}},
+		{Name: "pressure", Type: "webhook", URL: server.URL + "/pressure", Match: Match{Rules: []string{"pressure"}}},
+		{Name: "incidents", Type: "webhook", URL: server.URL + "/incidents", Match: Match{Rules: []string{"incident"}}},
+	}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	incident := testAlert
+	incident.Measurement = "incident"
+	incident.Rule = "incident"
+	temperature := testAlert
+	temperature.Measurement = "temperature"
+	temperature.Rule = "temperature"
+	err = dispatcher.NotifyGroup(incident, []alerts.Alert{testAlert, temperature})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for path, want := range map[string]bool{"/wind": true, "/pressure": false, "/incidents": false} {
+		if _, called := calls.Load(path); called != want {
+			t.Errorf("sink %s called = %v, want %v", path, called, want)
+		}
+	}
+}
+
+func TestEmailSink(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+
+	mail := make(chan string, 1)
+	go serveSMTP(listener, mail)
+
+	port, _ := strconv.Atoi(strings.Split(listener.Addr().String(), ":")[1])
+	dispatcher, err := NewDispatcher(Config{Sinks: []SinkConfig{{
+		Name: "duty",
+		Type: "email",
+		SMTP: SMTPConfig{Host: "127.0.0.1", Port: port, From: "alerts@airport.test", To: []string{"duty@airport.test"}},
+	}}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = dispatcher.Notify(testAlert)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	data := <-mail
+	if !strings.Contains(data, "Subject: [critical] wind alert for MRS") {
+		t.Errorf("unexpected subject in mail: %s", data)
+	}
+	if !strings.Contains(data, testAlert.Message) {
+		t.Errorf("unexpected body in mail: %s", data)
+	}
+}
+
+// serveSMTP answers a single SMTP session and sends the received DATA on mail.
+func serveSMTP(listener net.Listener, mail chan<- string) {
+	conn, err := listener.Accept()
+	if err != nil {
+		return
+	}
+	defer conn.Close()
+
+	reader := bufio.NewReader(conn)
+	reply := func(line string) {
+		conn.Write([]byte(line + "\r\n"))
+	}
+
+	reply("220 localhost ESMTP")
+	for {
+		line, err := reader.ReadString('\n')
+		if err != nil {
+			return
+		}
+		command := strings.ToUpper(strings.TrimSpace(line))
+		switch {
+		case strings.HasPrefix(command, "EHLO"), strings.HasPrefix(command, "HELO"):
+			reply("250 localhost")
+		case strings.HasPrefix(command, "DATA"):
+			reply("354 end data with <CR><LF>.<CR><LF>")
+			var data strings.Builder
+			for {
+				line, err := reader.ReadString('\n')
+				if err != nil {
+					return
+				}
+				if line == ".\r\n" {
+					break
+				}
+				data.WriteString(line)
+			}
+			mail <- data.String()
+			reply("250 OK")
+		case strings.HasPrefix(command, "QUIT"):
+			reply("221 bye")
+			return
+		default:
+			reply("250 OK")
+		}
+	}
+}
+
+func TestEscalationSteps(t *testing.T) {
+	policy := EscalationPolicy{
+		Steps: []EscalationStep{
+			{After: 0, Targets: []string{OnCallTarget}},
+			{After: 15 * time.Minute, Targets: []string{"managers"}},
+		},
+		Repeat: RepeatRule{Interval: 30 * time.Minute, Times: 2},
+	}
+
+	expected := []time.Duration{0, 15 * time.Minute, 45 * time.Minute, 75 * time.Minute}
+	for sent, delay := range expected {
+		_, after, ok := policy.Next(sent)
+		if !ok || after != delay {
+			t.Errorf("notification %d: got %v (%v), want %v", sent, after, ok, delay)
+		}
+	}
+	if _, _, ok := policy.Next(len(expected)); ok {
+		t.Errorf("expected the policy to be exhausted after %d notifications", len(expected))
+	}
+}
+
+func TestOnCallRouting(t *testing.T) {
+	var received []string
+	var mutex sync.Mutex
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mutex.Lock()
+		received = append(received, r.URL.Path)
+		mutex.Unlock()
+	}))
+	defer server.Close()
+
+	start := time.Date(2024, 1, 15, 8, 0, 0, 0, time.UTC)
+	dispatcher, err := NewDispatcher(Config{
+		Sinks: []SinkConfig{
+			{Name: "alice", Type: "webhook", URL: server.URL + "/alice", EscalationOnly: true},
+			{Name: "bob", Type: "webhook", URL: server.URL + "/bob", EscalationOnly: true},
+		},
+		OnCall: map[string]OnCallSchedule{"MRS": {Start: start, Rotation: []string{"alice", "bob"}}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = dispatcher.Notify(testAlert)
+	if err != nil || len(received) != 0 {
+		t.Fatalf("escalation only sinks received a regular notification: %v %v", received, err)
+	}
+
+	err = dispatcher.NotifyTargets(testAlert, []string{OnCallTarget}, start.Add(8*24*time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(received) != 1 || received[0] != "/bob" {
+		t.Errorf("expected bob to be on call the second week, got %v", received)
+	}
+}
@@ -0,0 +1,160 @@
+package notifications
+
+import (
+	"ArchiD-Projet/internal/alerts"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"net/smtp"
+	"os"
+	"strconv"
+	"strings"
+	"text/template"
+	"time"
+)
+
+var httpClient = &http.Client{Timeout: 10 * time.Second}
+
+type webhookSink struct {
+	url     string
+	headers map[string]string
+}
+
+type webhookPayload struct {
+	alerts.Alert
+	Text string `json:"text"`
+}
+
+func newWebhookSink(config SinkConfig) (Sink, error) {
+	if config.URL == "" {
+		return nil, fmt.Errorf("missing url")
+	}
+	return &webhookSink{url: config.URL, headers: config.Headers}, nil
+}
+
+func (sink *webhookSink) Send(alert alerts.Alert, message string) error {
+	return postJSON(sink.url, sink.headers, webhookPayload{Alert: alert, Text: message})
+}
+
+type chatSink struct {
+	url     string
+	headers map[string]string
+	payload func(alert alerts.Alert, message string) interface{}
+}
+
+func newChatSink(config SinkConfig, payload func(alert alerts.Alert, message string) interface{}) (Sink, error) {
+	if config.URL == "" {
+		return nil, fmt.Errorf("missing url")
+	}
+	return &chatSink{url: config.URL, headers: config.Headers, payload: payload}, nil
+}
+
+func (sink *chatSink) Send(alert alerts.Alert, message string) error {
+	return postJSON(sink.url, sink.headers, sink.payload(alert, message))
+}
+
+func slackPayload(_ alerts.Alert, message string) interface{} {
+	return map[string]string{"text": message}
+}
+
+func teamsPayload(alert alerts.Alert, message string) interface{} {
+	themeColor := "FFA500"
+	switch alert.Severity {
+	case alerts.SeverityCritical:
+		themeColor = "FF0000"
+	case alerts.SeverityInfo:
+		themeColor = "0078D7"
+	}
+
+	return map[string]string{
+		"@type":      "MessageCard",
+		"@context":   "http://schema.org/extensions",
+		"themeColor": themeColor,
+		"summary":    fmt.Sprintf("%s alert for %s", alert.Measurement, alert.Airport),
+		"text":       message,
+	}
+}
+
+func postJSON(url string, headers map[string]string, payload interface{}) error {
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return fmt.Errorf("error encoding payload: %v", err)
+	}
+
+	req, err := http.NewRequest("POST", url, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("error creating HTTP request: %v", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for key, value := range headers {
+		req.Header.Set(key, value)
+	}
+
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("error making HTTP request: %v", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("unexpected status code: %d", resp.StatusCode)
+	}
+	return nil
+}
+
+type emailSink struct {
+	config  SMTPConfig
+	subject *template.Template
+}
+
+func newEmailSink(config SinkConfig) (Sink, error) {
+	if config.SMTP.Host == "" || config.SMTP.From == "" || len(config.SMTP.To) == 0 {
+		return nil, fmt.Errorf("incomplete smtp configuration")
+	}
+
+	text := config.Subject
+	if text == "" {
+		text = "[{{.Severity}}] {{.Measurement}} alert for {{.Airport}}"
+	}
+	subject, err := template.New(config.Name + "_subject").Parse(text)
+	if err != nil {
+		return nil, fmt.Errorf("error parsing subject template: %v", err)
+	}
+
+	return &emailSink{config: config.SMTP, subject: subject}, nil
+}
+
+func (sink *emailSink) Send(alert alerts.Alert, message string) error {
+	var subject bytes.Buffer
+	err := sink.subject.Execute(&subject, alert)
+	if err != nil {
+		return fmt.Errorf("error rendering subject: %v", err)
+	}
+
+	port := sink.config.Port
+	if port == 0 {
+		port = 25
+	}
+	address := net.JoinHostPort(sink.config.Host, strconv.Itoa(port))
+
+	var auth smtp.Auth
+	if sink.config.Username != "" {
+		auth = smtp.PlainAuth("", sink.config.Username, os.Getenv(sink.config.PasswordEnv), sink.config.Host)
+	}
+
+	var mail strings.Builder
+	mail.WriteString("From: " + sink.config.From + "\r\n")
+	mail.WriteString("To: " + strings.Join(sink.config.To, ", ") + "\r\n")
+	mail.WriteString("Subject: " + subject.String() + "\r\n")
+	mail.WriteString("Content-Type: text/plain; charset=UTF-8\r\n")
+	mail.WriteString("\r\n")
+	mail.WriteString(message + "\r\n")
+
+	err = smtp.SendMail(address, auth, sink.config.From, sink.config.To, []byte(mail.String()))
+	if err != nil {
+		return fmt.Errorf("error sending mail: %v", err)
+	}
+	return nil
+}
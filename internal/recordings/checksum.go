@@ -0,0 +1,73 @@
+package recordings
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// ChecksumExtension is added to a recording for its manifest, a line in the format of
+// sha256sum so that archived files can also be checked with "sha256sum -c".
+const ChecksumExtension = ".sha256"
+
+func checksum(path string) (string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+
+	hash := sha256.New()
+	_, err = io.Copy(hash, file)
+	if err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
+
+// WriteChecksum writes the manifest of a complete recording.
+func WriteChecksum(path string) error {
+	sum, err := checksum(path)
+	if err != nil {
+		return err
+	}
+
+	temporary := path + ChecksumExtension + ".tmp"
+	err = os.WriteFile(temporary, []byte(sum+"  "+filepath.Base(path)+"\n"), 0644)
+	if err != nil {
+		return err
+	}
+	return os.Rename(temporary, path+ChecksumExtension)
+}
+
+// VerifyChecksum checks a recording against its manifest.
+func VerifyChecksum(path string) error {
+	file, err := os.Open(path + ChecksumExtension)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	line, err := bufio.NewReader(file).ReadString('\n')
+	if err != nil && err != io.EOF {
+		return err
+	}
+	expected, name, ok := strings.Cut(strings.TrimSpace(line), "  ")
+	if !ok || name != filepath.Base(path) {
+		return fmt.Errorf("invalid manifest %s", path+ChecksumExtension)
+	}
+
+	sum, err := checksum(path)
+	if err != nil {
+		return err
+	}
+	if sum != expected {
+		return fmt.Errorf("checksum mismatch for %s", path)
+	}
+	return nil
+}
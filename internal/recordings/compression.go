@@ -0,0 +1,178 @@
+package recordings
+
+import (
+	"compress/gzip"
+	"fmt"
+	"github.com/klauspost/compress/zstd"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+const (
+	CompressionNone = "none"
+	CompressionGzip = "gzip"
+	CompressionZstd = "zstd"
+)
+
+var compressionExtensions = map[string]string{
+	CompressionGzip: ".gz",
+	CompressionZstd: ".zst",
+}
+
+func ValidCompression(method string) bool {
+	_, ok := compressionExtensions[method]
+	return ok || method == "" || method == CompressionNone
+}
+
+// IsCompressed tells whether a recording has been compressed.
+func IsCompressed(path string) bool {
+	for _, extension := range compressionExtensions {
+		if strings.HasSuffix(path, extension) {
+			return true
+		}
+	}
+	return false
+}
+
+// TrimCompression returns the path of a recording without its compression extension.
+func TrimCompression(path string) string {
+	for _, extension := range compressionExtensions {
+		if strings.HasSuffix(path, extension) {
+			return strings.TrimSuffix(path, extension)
+		}
+	}
+	return path
+}
+
+// PartPath returns the path of the part n of a recording, "MRS_2024-01-19.csv" becoming
+// "MRS_2024-01-19.1.csv".
+func PartPath(path string, n int) string {
+	extension := filepath.Ext(path)
+	return strings.TrimSuffix(path, extension) + "." + strconv.Itoa(n) + extension
+}
+
+// NextPartPath returns the first part path of a recording that is free, compressed or not.
+func NextPartPath(path string) string {
+	for n := 1; ; n++ {
+		part := PartPath(path, n)
+		if !exists(part) && !exists(part+compressionExtensions[CompressionGzip]) && !exists(part+compressionExtensions[CompressionZstd]) {
+			return part
+		}
+	}
+}
+
+func exists(path string) bool {
+	_, err := os.Stat(path)
+	return err == nil
+}
+
+// CompressFile compresses a recording next to it and removes the original, a recording
+// that was already compressed under the same name is compressed as its next part.
+func CompressFile(path string, method string) (string, error) {
+	extension, ok := compressionExtensions[method]
+	if !ok {
+		return "", fmt.Errorf("unknown compression: %s", method)
+	}
+
+	target := path + extension
+	if exists(target) {
+		target = NextPartPath(path) + extension
+	}
+
+	source, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer source.Close()
+
+	// The compressed file only gets its final name once complete
+	temporary := target + ".tmp"
+	destination, err := os.Create(temporary)
+	if err != nil {
+		return "", err
+	}
+
+	err = compress(destination, source, method)
+	if err == nil {
+		err = destination.Sync()
+	}
+	closeErr := destination.Close()
+	if err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(temporary, target)
+	}
+	if err != nil {
+		os.Remove(temporary)
+		return "", err
+	}
+
+	return target, os.Remove(path)
+}
+
+func compress(destination io.Writer, source io.Reader, method string) error {
+	var writer io.WriteCloser
+	switch method {
+	case CompressionGzip:
+		writer = gzip.NewWriter(destination)
+	case CompressionZstd:
+		encoder, err := zstd.NewWriter(destination)
+		if err != nil {
+			return err
+		}
+		writer = encoder
+	}
+
+	_, err := io.Copy(writer, source)
+	if err != nil {
+		writer.Close()
+		return err
+	}
+	return writer.Close()
+}
+
+type decompressingReader struct {
+	io.Reader
+	close func() error
+}
+
+func (reader decompressingReader) Close() error {
+	return reader.close()
+}
+
+// Open opens a recording, decompressing it according to its extension.
+func Open(path string) (io.ReadCloser, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+
+	switch {
+	case strings.HasSuffix(path, compressionExtensions[CompressionGzip]):
+		reader, err := gzip.NewReader(file)
+		if err != nil {
+			file.Close()
+			return nil, err
+		}
+		return decompressingReader{Reader: reader, close: func() error {
+			reader.Close()
+			return file.Close()
+		}}, nil
+	case strings.HasSuffix(path, compressionExtensions[CompressionZstd]):
+		decoder, err := zstd.NewReader(file)
+		if err != nil {
+			file.Close()
+			return nil, err
+		}
+		return decompressingReader{Reader: decoder, close: func() error {
+			decoder.Close()
+			return file.Close()
+		}}, nil
+	default:
+		return file, nil
+	}
+}
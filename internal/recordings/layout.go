@@ -0,0 +1,235 @@
+package recordings
+
+import (
+	"fmt"
+	"io/fs"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+)
+
+// DefaultPathTemplate is the flat layout of the recordings, "MRS_2024-01-19.csv".
+const DefaultPathTemplate = "{airport}_{yyyy}-{MM}-{dd}{ext}"
+
+// Placeholders of a path template with their partition key and pattern.
+var placeholders = map[string]struct {
+	key     string
+	pattern string
+}{
+	"airport":     {"airport", `[^/]+?`},
+	"measurement": {"measurement", `[^/]+?`},
+	"yyyy":        {"year", `\d{4}`},
+	"MM":          {"month", `\d{2}`},
+	"dd":          {"day", `\d{2}`},
+	"ext":         {"ext", `\.[^/.]+`},
+}
+
+var placeholder = regexp.MustCompile(`\{(\w+)\}`)
+
+// Rotated parts are numbered before the extension, "19.1.csv".
+var partSuffix = regexp.MustCompile(`\.\d+$`)
+
+type templateSegment struct {
+	literal string
+	// Placeholder name, empty for a literal
+	name string
+	// A directory made of a single placeholder is named "<key>=<value>" in Hive layouts
+	hive bool
+}
+
+// A Layout places the daily recordings of an airport, and optionally of a measurement,
+// under the recording directory following a path template.
+type Layout struct {
+	segments []templateSegment
+	pattern  *regexp.Regexp
+	// The files are per measurement when the template has one
+	PerMeasurement bool
+}
+
+// A Partition is what the path of a recording tells about its records.
+type Partition struct {
+	Airport     string
+	Measurement string
+	Day         time.Time
+}
+
+// NewLayout parses a path template such as "{airport}/{measurement}/{yyyy}/{MM}/{dd}.csv".
+// {ext} is the extension of the format and is added when the template has none. With
+// hive, the directories of a single placeholder are named like "year=2024" so that query
+// engines can prune them.
+func NewLayout(template string, hive bool, format string) (*Layout, error) {
+	if template == "" {
+		template = DefaultPathTemplate
+	}
+	template = filepath.ToSlash(template)
+
+	extension := filepath.Ext(template)
+	if !strings.Contains(template, "{ext}") {
+		if extension == "" {
+			template += "{ext}"
+		} else if format != "" && extension != Extension(format) {
+			return nil, fmt.Errorf("path template %s does not match the extension %s of the format %s", template, Extension(format), format)
+		}
+	}
+	for _, name := range []string{"airport", "yyyy", "MM", "dd"} {
+		if !strings.Contains(template, "{"+name+"}") {
+			return nil, fmt.Errorf("path template %s has no {%s}", template, name)
+		}
+	}
+
+	layout := &Layout{}
+	var pattern strings.Builder
+	pattern.WriteString("^")
+	components := strings.Split(template, "/")
+	for i, component := range components {
+		if i > 0 {
+			layout.segments = append(layout.segments, templateSegment{literal: "/"})
+			pattern.WriteString("/")
+		}
+
+		matches := placeholder.FindAllStringSubmatchIndex(component, -1)
+		directory := i < len(components)-1
+		if hive && directory && len(matches) == 1 && matches[0][0] == 0 && matches[0][1] == len(component) {
+			name := component[matches[0][2]:matches[0][3]]
+			if _, ok := placeholders[name]; !ok {
+				return nil, fmt.Errorf("unknown placeholder {%s} in path template %s", name, template)
+			}
+			layout.segments = append(layout.segments, templateSegment{name: name, hive: true})
+			fmt.Fprintf(&pattern, "%s=(?P<%s>%s)", placeholders[name].key, placeholders[name].key, placeholders[name].pattern)
+			continue
+		}
+
+		start := 0
+		for _, match := range matches {
+			name := component[match[2]:match[3]]
+			if _, ok := placeholders[name]; !ok {
+				return nil, fmt.Errorf("unknown placeholder {%s} in path template %s", name, template)
+			}
+			if match[0] > start {
+				layout.segments = append(layout.segments, templateSegment{literal: component[start:match[0]]})
+				pattern.WriteString(regexp.QuoteMeta(component[start:match[0]]))
+			}
+			layout.segments = append(layout.segments, templateSegment{name: name})
+			fmt.Fprintf(&pattern, "(?P<%s>%s)", placeholders[name].key, placeholders[name].pattern)
+			start = match[1]
+		}
+		if start < len(component) {
+			layout.segments = append(layout.segments, templateSegment{literal: component[start:]})
+			pattern.WriteString(regexp.QuoteMeta(component[start:]))
+		}
+	}
+	pattern.WriteString("$")
+
+	var err error
+	layout.pattern, err = regexp.Compile(pattern.String())
+	if err != nil {
+		return nil, err
+	}
+	layout.PerMeasurement = strings.Contains(template, "{measurement}")
+	return layout, nil
+}
+
+// Path returns the path of the recording of a record relative to the recording directory.
+func (l *Layout) Path(record Record, format string) string {
+	day := record.Time.In(SensorZone)
+	values := map[string]string{
+		"airport":     record.Airport,
+		"measurement": record.Measurement,
+		"yyyy":        day.Format("2006"),
+		"MM":          day.Format("01"),
+		"dd":          day.Format("02"),
+		"ext":         Extension(format),
+	}
+
+	var path strings.Builder
+	for _, segment := range l.segments {
+		if segment.name == "" {
+			path.WriteString(segment.literal)
+			continue
+		}
+		if segment.hive {
+			path.WriteString(placeholders[segment.name].key + "=")
+		}
+		path.WriteString(values[segment.name])
+	}
+	return filepath.FromSlash(path.String())
+}
+
+// Match returns the partition of a recording from its path relative to the recording
+// directory, rotated parts and compressed files included.
+func (l *Layout) Match(path string) (Partition, bool) {
+	path = TrimCompression(filepath.ToSlash(path))
+	match := l.pattern.FindStringSubmatch(path)
+	if match == nil {
+		extension := filepath.Ext(path)
+		base := strings.TrimSuffix(path, extension)
+		if !partSuffix.MatchString(base) {
+			return Partition{}, false
+		}
+		match = l.pattern.FindStringSubmatch(partSuffix.ReplaceAllString(base, "") + extension)
+		if match == nil {
+			return Partition{}, false
+		}
+	}
+
+	values := make(map[string]string)
+	for i, name := range l.pattern.SubexpNames() {
+		if name != "" {
+			values[name] = match[i]
+		}
+	}
+	if _, ok := values["ext"]; ok && !IsRecording(values["ext"]) {
+		return Partition{}, false
+	}
+
+	day, err := time.ParseInLocation("2006-01-02", values["year"]+"-"+values["month"]+"-"+values["day"], SensorZone)
+	if err != nil {
+		return Partition{}, false
+	}
+	return Partition{Airport: values["airport"], Measurement: values["measurement"], Day: day}, true
+}
+
+// A File is a recording found under a recording directory.
+type File struct {
+	Path string
+	Partition
+}
+
+// Find returns the recordings under a directory for the days in [from, to) and the
+// airports, all of them when airports is empty, sorted by day, airport and path.
+func Find(dir string, layout *Layout, from time.Time, to time.Time, airports []string) ([]File, error) {
+	var files []File
+	err := filepath.WalkDir(dir, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil || entry.IsDir() {
+			return err
+		}
+		relative, err := filepath.Rel(dir, path)
+		if err != nil {
+			return err
+		}
+		partition, ok := layout.Match(relative)
+		if !ok || !partition.Day.AddDate(0, 0, 1).After(from) || !partition.Day.Before(to) {
+			return nil
+		}
+		if len(airports) > 0 && !slices.Contains(airports, partition.Airport) {
+			return nil
+		}
+
+		files = append(files, File{Path: path, Partition: partition})
+		return nil
+	})
+
+	sort.Slice(files, func(i, j int) bool {
+		if !files[i].Day.Equal(files[j].Day) {
+			return files[i].Day.Before(files[j].Day)
+		}
+		if files[i].Airport != files[j].Airport {
+			return files[i].Airport < files[j].Airport
+		}
+		return files[i].Path < files[j].Path
+	})
+	return files, err
+}
@@ -0,0 +1,607 @@
+package recordings
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"github.com/klauspost/compress/zstd"
+	"io"
+	"math"
+	"os"
+	"time"
+)
+
+// Parquet files have one flat schema of required columns, written with the PLAIN
+// encoding and one data page per column chunk. A new footer is appended after every row
+// group so that the file stays readable while the day is recorded. The previous footer is
+// left in place, a file torn while appending can be cut back to it by Repair. Once the
+// day is over, CompactParquet rewrites the file without these previous footers.
+
+const parquetMagic = "PAR1"
+
+const (
+	parquetInt64     = 2
+	parquetDouble    = 5
+	parquetByteArray = 6
+
+	parquetUTF8            = 0
+	parquetTimestampMillis = 9
+
+	parquetPlain = 0
+	parquetRLE   = 3
+
+	parquetUncompressed = 0
+	parquetGzip         = 2
+	parquetZstd         = 6
+)
+
+var parquetCodecs = map[string]int32{
+	CompressionGzip: parquetGzip,
+	CompressionZstd: parquetZstd,
+}
+
+var errParquet = errors.New("invalid parquet file")
+
+type parquetColumn struct {
+	name         string
+	physicalType int32
+	// Converted type of the column, -1 when there is none
+	convertedType int32
+}
+
+// The columns follow CSVHeader.
+var parquetColumns = []parquetColumn{
+	{"airport", parquetByteArray, parquetUTF8},
+	{"timestamp", parquetInt64, parquetTimestampMillis},
+	{"measurement", parquetByteArray, parquetUTF8},
+	{"value", parquetDouble, -1},
+	{"unit", parquetByteArray, parquetUTF8},
+	{"sensor_id", parquetByteArray, parquetUTF8},
+}
+
+type columnChunk struct {
+	name             string
+	physicalType     int32
+	codec            int32
+	offset           int64
+	numValues        int64
+	uncompressedSize int64
+	compressedSize   int64
+}
+
+type rowGroup struct {
+	numRows int64
+	columns []columnChunk
+}
+
+// parquetWriter buffers the records of the current hour and writes them as a row group
+// once a record of a later hour arrives, the hour is over or the file is closed.
+type parquetWriter struct {
+	file      *os.File
+	codec     int32
+	rowGroups []rowGroup
+	// Start of the last footer and end of the file
+	end  int64
+	size int64
+	rows []Record
+	hour time.Time
+}
+
+func openParquet(path string, compression string) (*parquetWriter, error) {
+	file, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0644)
+	if err != nil {
+		return nil, err
+	}
+	w := &parquetWriter{file: file, codec: parquetCodecs[compression]}
+
+	info, err := file.Stat()
+	if err == nil && info.Size() == 0 {
+		_, err = file.WriteString(parquetMagic)
+		w.end = int64(len(parquetMagic))
+		w.size = w.end
+	} else if err == nil {
+		// Appending to the file of a day recorded before a restart
+		w.rowGroups, w.end, err = readParquetFooter(file, info.Size())
+		w.size = info.Size()
+	}
+	if err != nil {
+		file.Close()
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return w, nil
+}
+
+func (w *parquetWriter) Write(record Record) error {
+	hour := record.Time.Truncate(time.Hour)
+	if len(w.rows) > 0 && hour.After(w.hour) {
+		err := w.writeRowGroup()
+		if err != nil {
+			return err
+		}
+	}
+	if len(w.rows) == 0 {
+		w.hour = hour
+	}
+	w.rows = append(w.rows, record)
+	return nil
+}
+
+func (w *parquetWriter) Sync(now time.Time) error {
+	if len(w.rows) > 0 && now.Truncate(time.Hour).After(w.hour) {
+		err := w.writeRowGroup()
+		if err != nil {
+			return err
+		}
+	}
+	return w.file.Sync()
+}
+
+func (w *parquetWriter) Size() int64 {
+	return w.size
+}
+
+// Close writes the buffered records and the final footer.
+func (w *parquetWriter) Close() error {
+	var err error
+	if len(w.rows) > 0 {
+		err = w.writeRowGroup()
+	} else {
+		err = w.writeFooter()
+	}
+	if err == nil {
+		err = w.file.Sync()
+	}
+	closeErr := w.file.Close()
+	if err != nil {
+		return err
+	}
+	return closeErr
+}
+
+func (w *parquetWriter) writeRowGroup() error {
+	group := rowGroup{numRows: int64(len(w.rows))}
+	offset := w.size
+
+	for _, column := range parquetColumns {
+		page := encodePlain(w.rows, column.name)
+		compressed, err := compressPage(page, w.codec)
+		if err != nil {
+			return err
+		}
+		header := pageHeader(len(w.rows), len(page), len(compressed))
+
+		_, err = w.file.WriteAt(append(header, compressed...), offset)
+		if err != nil {
+			return err
+		}
+		group.columns = append(group.columns, columnChunk{
+			name:             column.name,
+			physicalType:     column.physicalType,
+			codec:            w.codec,
+			offset:           offset,
+			numValues:        int64(len(w.rows)),
+			uncompressedSize: int64(len(header) + len(page)),
+			compressedSize:   int64(len(header) + len(compressed)),
+		})
+		offset += int64(len(header) + len(compressed))
+	}
+
+	w.rowGroups = append(w.rowGroups, group)
+	w.end = offset
+	w.rows = nil
+	return w.writeFooter()
+}
+
+func (w *parquetWriter) writeFooter() error {
+	footer := encodeFooter(w.rowGroups)
+	footer = binary.LittleEndian.AppendUint32(footer, uint32(len(footer)))
+	footer = append(footer, parquetMagic...)
+
+	_, err := w.file.WriteAt(footer, w.end)
+	if err != nil {
+		return err
+	}
+	w.size = w.end + int64(len(footer))
+	return nil
+}
+
+func encodePlain(rows []Record, column string) []byte {
+	var page []byte
+	for _, record := range rows {
+		switch column {
+		case "timestamp":
+			page = binary.LittleEndian.AppendUint64(page, uint64(record.Time.UnixMilli()))
+		case "value":
+			page = binary.LittleEndian.AppendUint64(page, math.Float64bits(record.Value))
+		default:
+			value := stringField(&record, column)
+			page = binary.LittleEndian.AppendUint32(page, uint32(len(*value)))
+			page = append(page, *value...)
+		}
+	}
+	return page
+}
+
+// stringField returns the field of a record stored in a byte array column.
+func stringField(record *Record, column string) *string {
+	switch column {
+	case "airport":
+		return &record.Airport
+	case "measurement":
+		return &record.Measurement
+	case "unit":
+		return &record.Unit
+	case "sensor_id":
+		return &record.SensorID
+	}
+	return nil
+}
+
+func compressPage(page []byte, codec int32) ([]byte, error) {
+	switch codec {
+	case parquetGzip:
+		var buffer bytes.Buffer
+		writer := gzip.NewWriter(&buffer)
+		writer.Write(page)
+		err := writer.Close()
+		return buffer.Bytes(), err
+	case parquetZstd:
+		encoder, err := zstd.NewWriter(nil)
+		if err != nil {
+			return nil, err
+		}
+		defer encoder.Close()
+		return encoder.EncodeAll(page, nil), nil
+	default:
+		return page, nil
+	}
+}
+
+func decompressPage(page []byte, codec int64) ([]byte, error) {
+	switch codec {
+	case parquetUncompressed:
+		return page, nil
+	case parquetGzip:
+		reader, err := gzip.NewReader(bytes.NewReader(page))
+		if err != nil {
+			return nil, err
+		}
+		return io.ReadAll(reader)
+	case parquetZstd:
+		decoder, err := zstd.NewReader(nil)
+		if err != nil {
+			return nil, err
+		}
+		defer decoder.Close()
+		return decoder.DecodeAll(page, nil)
+	default:
+		return nil, fmt.Errorf("unsupported parquet codec %d", codec)
+	}
+}
+
+func pageHeader(numValues int, uncompressedSize int, compressedSize int) []byte {
+	t := &thriftWriter{}
+	t.beginStruct()
+	t.i32(1, 0) // DATA_PAGE
+	t.i32(2, int32(uncompressedSize))
+	t.i32(3, int32(compressedSize))
+	t.structField(5)
+	t.i32(1, int32(numValues))
+	t.i32(2, parquetPlain)
+	t.i32(3, parquetRLE)
+	t.i32(4, parquetRLE)
+	t.endStruct()
+	t.endStruct()
+	return t.buffer.Bytes()
+}
+
+func encodeFooter(rowGroups []rowGroup) []byte {
+	var numRows int64
+	for _, group := range rowGroups {
+		numRows += group.numRows
+	}
+
+	t := &thriftWriter{}
+	t.beginStruct()
+	t.i32(1, 1)
+
+	t.list(2, thriftStruct, len(parquetColumns)+1)
+	t.beginStruct()
+	t.binary(4, "schema")
+	t.i32(5, int32(len(parquetColumns)))
+	t.endStruct()
+	for _, column := range parquetColumns {
+		t.beginStruct()
+		t.i32(1, column.physicalType)
+		t.i32(3, 0) // REQUIRED
+		t.binary(4, column.name)
+		if column.convertedType >= 0 {
+			t.i32(6, column.convertedType)
+		}
+		t.endStruct()
+	}
+
+	t.i64(3, numRows)
+
+	t.list(4, thriftStruct, len(rowGroups))
+	for _, group := range rowGroups {
+		var totalSize int64
+		t.beginStruct()
+		t.list(1, thriftStruct, len(group.columns))
+		for _, chunk := range group.columns {
+			totalSize += chunk.uncompressedSize
+			t.beginStruct()
+			t.i64(2, chunk.offset)
+			t.structField(3)
+			t.i32(1, chunk.physicalType)
+			t.list(2, thriftI32, 1)
+			t.varint(parquetPlain)
+			t.list(3, thriftBinary, 1)
+			t.bytes(chunk.name)
+			t.i32(4, chunk.codec)
+			t.i64(5, chunk.numValues)
+			t.i64(6, chunk.uncompressedSize)
+			t.i64(7, chunk.compressedSize)
+			t.i64(9, chunk.offset)
+			t.endStruct()
+			t.endStruct()
+		}
+		t.i64(2, totalSize)
+		t.i64(3, group.numRows)
+		t.endStruct()
+	}
+
+	t.binary(6, "ArchiD-Projet filerecorder")
+	t.endStruct()
+	return t.buffer.Bytes()
+}
+
+// readParquetFooter returns the row groups of a file and the offset of its footer.
+func readParquetFooter(file io.ReaderAt, size int64) ([]rowGroup, int64, error) {
+	trailer := make([]byte, 8)
+	if size < int64(2*len(parquetMagic)+4) {
+		return nil, 0, errParquet
+	}
+	_, err := file.ReadAt(trailer, size-8)
+	if err != nil {
+		return nil, 0, err
+	}
+	length := int64(binary.LittleEndian.Uint32(trailer))
+	if string(trailer[4:]) != parquetMagic || length > size-12 {
+		return nil, 0, errParquet
+	}
+
+	footer := make([]byte, length)
+	end := size - 8 - length
+	_, err = file.ReadAt(footer, end)
+	if err != nil {
+		return nil, 0, err
+	}
+	metadata, err := thriftReader{bytes.NewReader(footer)}.readStruct()
+	if err != nil {
+		return nil, 0, errParquet
+	}
+
+	var rowGroups []rowGroup
+	for _, value := range metadata.list(4) {
+		fields, _ := value.(thriftFields)
+		group := rowGroup{numRows: fields.int(3)}
+		for _, chunkValue := range fields.list(1) {
+			chunkFields, _ := chunkValue.(thriftFields)
+			meta := chunkFields.structure(3)
+			path := meta.list(3)
+			if meta == nil || len(path) != 1 {
+				return nil, 0, errParquet
+			}
+			name, _ := path[0].([]byte)
+			group.columns = append(group.columns, columnChunk{
+				name:             string(name),
+				physicalType:     int32(meta.int(1)),
+				codec:            int32(meta.int(4)),
+				offset:           meta.int(9),
+				numValues:        meta.int(5),
+				uncompressedSize: meta.int(6),
+				compressedSize:   meta.int(7),
+			})
+		}
+		rowGroups = append(rowGroups, group)
+	}
+	return rowGroups, end, nil
+}
+
+// CompactParquet rewrites a Parquet recording with its row groups next to each other and
+// a single footer, dropping the footers left by the previous appends. The file is
+// replaced once the copy is complete. It returns false when there was nothing to drop.
+func CompactParquet(path string) (bool, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return false, err
+	}
+	defer file.Close()
+
+	info, err := file.Stat()
+	if err != nil {
+		return false, err
+	}
+	rowGroups, end, err := readParquetFooter(file, info.Size())
+	if err != nil {
+		return false, fmt.Errorf("%s: %w", path, err)
+	}
+
+	size := int64(len(parquetMagic))
+	for _, group := range rowGroups {
+		for _, chunk := range group.columns {
+			if chunk.offset < int64(len(parquetMagic)) || chunk.compressedSize < 0 || chunk.offset+chunk.compressedSize > end {
+				return false, fmt.Errorf("%s: %w", path, errParquet)
+			}
+			size += chunk.compressedSize
+		}
+	}
+	if size == end {
+		return false, nil
+	}
+
+	temporary := path + ".tmp"
+	destination, err := os.Create(temporary)
+	if err != nil {
+		return false, err
+	}
+	w := &parquetWriter{file: destination}
+	err = w.copyRowGroups(file, rowGroups)
+	if err == nil {
+		err = w.writeFooter()
+	}
+	if err == nil {
+		err = destination.Sync()
+	}
+	closeErr := destination.Close()
+	if err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(temporary, path)
+	}
+	if err != nil {
+		os.Remove(temporary)
+		return false, err
+	}
+	return true, nil
+}
+
+// copyRowGroups writes the magic and the column chunks of the row groups of a file one
+// after the other. The page headers hold no offset, the chunks are copied as they are.
+func (w *parquetWriter) copyRowGroups(source io.ReaderAt, rowGroups []rowGroup) error {
+	_, err := w.file.WriteString(parquetMagic)
+	if err != nil {
+		return err
+	}
+	offset := int64(len(parquetMagic))
+
+	for _, group := range rowGroups {
+		copied := rowGroup{numRows: group.numRows}
+		for _, chunk := range group.columns {
+			data := make([]byte, chunk.compressedSize)
+			_, err = source.ReadAt(data, chunk.offset)
+			if err != nil {
+				return err
+			}
+			_, err = w.file.WriteAt(data, offset)
+			if err != nil {
+				return err
+			}
+			chunk.offset = offset
+			copied.columns = append(copied.columns, chunk)
+			offset += chunk.compressedSize
+		}
+		w.rowGroups = append(w.rowGroups, copied)
+	}
+	w.end = offset
+	return nil
+}
+
+// ReadParquet reads the records of a Parquet recording.
+func ReadParquet(path string) ([]Record, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	info, err := file.Stat()
+	if err != nil {
+		return nil, err
+	}
+	rowGroups, end, err := readParquetFooter(file, info.Size())
+	if err != nil {
+		return nil, err
+	}
+
+	var records []Record
+	for _, group := range rowGroups {
+		rows := make([]Record, group.numRows)
+		for _, chunk := range group.columns {
+			if chunk.offset < 0 || chunk.compressedSize < 0 || chunk.offset+chunk.compressedSize > end {
+				return records, errParquet
+			}
+			data := make([]byte, chunk.compressedSize)
+			_, err := file.ReadAt(data, chunk.offset)
+			if err != nil {
+				return records, err
+			}
+			err = decodeChunk(data, chunk, rows)
+			if err != nil {
+				return records, err
+			}
+		}
+		records = append(records, rows...)
+	}
+	return records, nil
+}
+
+// decodeChunk decodes the data pages of a column chunk into the rows of its group.
+func decodeChunk(data []byte, chunk columnChunk, rows []Record) error {
+	row := 0
+	reader := bytes.NewReader(data)
+	for reader.Len() > 0 {
+		header, err := thriftReader{reader}.readStruct()
+		if err != nil {
+			return errParquet
+		}
+		compressedSize := header.int(3)
+		dataPage := header.structure(5)
+		if header.int(1) != 0 || dataPage == nil || dataPage.int(2) != parquetPlain || compressedSize > int64(reader.Len()) {
+			return fmt.Errorf("unsupported parquet page in column %s", chunk.name)
+		}
+
+		page := make([]byte, compressedSize)
+		reader.Read(page)
+		page, err = decompressPage(page, int64(chunk.codec))
+		if err != nil {
+			return err
+		}
+
+		numValues := int(dataPage.int(1))
+		if row+numValues > len(rows) {
+			return errParquet
+		}
+		err = decodePlain(page, chunk, rows[row:row+numValues])
+		if err != nil {
+			return err
+		}
+		row += numValues
+	}
+	return nil
+}
+
+func decodePlain(page []byte, chunk columnChunk, rows []Record) error {
+	for i := range rows {
+		switch chunk.physicalType {
+		case parquetInt64, parquetDouble:
+			if len(page) < 8 {
+				return errParquet
+			}
+			value := binary.LittleEndian.Uint64(page)
+			page = page[8:]
+			if chunk.name == "timestamp" {
+				rows[i].Time = time.UnixMilli(int64(value)).In(SensorZone)
+			} else if chunk.name == "value" {
+				rows[i].Value = math.Float64frombits(value)
+			}
+		case parquetByteArray:
+			if len(page) < 4 || int(binary.LittleEndian.Uint32(page)) > len(page)-4 {
+				return errParquet
+			}
+			length := int(binary.LittleEndian.Uint32(page))
+			value := string(page[4 : 4+length])
+			page = page[4+length:]
+			if field := stringField(&rows[i], chunk.name); field != nil {
+				*field = value
+			}
+		default:
+			return fmt.Errorf("unsupported parquet type %d in column %s", chunk.physicalType, chunk.name)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,226 @@
+package recordings
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// FormatCSV writes RFC 4180 CSV files with a header row
+	FormatCSV = "csv"
+	// FormatLegacy writes the original "<date> <time> <measurement> <value>" lines
+	FormatLegacy = "legacy"
+	// FormatJSONLines writes one JSON object per line
+	FormatJSONLines = "jsonl"
+	// FormatParquet writes columnar Parquet files with one row group per hour
+	FormatParquet = "parquet"
+)
+
+var extensions = map[string]string{
+	FormatCSV:       ".csv",
+	FormatLegacy:    ".csv",
+	FormatJSONLines: ".jsonl",
+	FormatParquet:   ".parquet",
+}
+
+// Sensors publish their timestamps in UTC+1.
+var SensorZone = time.FixedZone("UTC+1", 60*60)
+
+var CSVHeader = []string{"airport", "timestamp", "measurement", "value", "unit", "sensor_id"}
+
+// A Record is one reading of a sensor as stored in the recordings.
+type Record struct {
+	Airport     string    `json:"airport"`
+	Time        time.Time `json:"timestamp"`
+	Measurement string    `json:"measurement"`
+	Value       float64   `json:"value"`
+	Unit        string    `json:"unit"`
+	SensorID    string    `json:"sensor_id"`
+}
+
+// ParsePayload parses a sensor message "<date> <time> <measurement> <value>".
+func ParsePayload(airport string, payload string) (Record, error) {
+	data := strings.Split(strings.TrimSpace(payload), " ")
+	if len(data) != 4 {
+		return Record{}, fmt.Errorf("invalid reading: %q", payload)
+	}
+
+	timestamp, err := time.ParseInLocation("2006-01-02 15:04:05", data[0]+" "+data[1], SensorZone)
+	if err != nil {
+		return Record{}, err
+	}
+
+	value, err := strconv.ParseFloat(data[3], 64)
+	if err != nil {
+		return Record{}, err
+	}
+
+	return Record{Airport: airport, Time: timestamp, Measurement: data[2], Value: value}, nil
+}
+
+func ValidFormat(format string) bool {
+	_, ok := extensions[format]
+	return ok
+}
+
+// Extension returns the file extension of a format.
+func Extension(format string) string {
+	return extensions[format]
+}
+
+// IsRecording tells whether a file name has the extension of a format, compressed or not.
+func IsRecording(path string) bool {
+	extension := filepath.Ext(TrimCompression(path))
+	for _, formatExtension := range extensions {
+		if extension == formatExtension {
+			return true
+		}
+	}
+	return false
+}
+
+// Header returns the first line of a new file of the format, if any.
+func Header(format string) []byte {
+	if format != FormatCSV {
+		return nil
+	}
+	return csvLine(CSVHeader)
+}
+
+// Format returns the line of a record in a line based format.
+func Format(format string, record Record) []byte {
+	switch format {
+	case FormatLegacy:
+		return []byte(fmt.Sprintf("%s %s %f\n", record.Time.In(SensorZone).Format("2006-01-02 15:04:05"), record.Measurement, record.Value))
+	case FormatJSONLines:
+		line, _ := json.Marshal(record)
+		return append(line, '\n')
+	}
+
+	return csvLine([]string{
+		record.Airport,
+		record.Time.Format(time.RFC3339),
+		record.Measurement,
+		strconv.FormatFloat(record.Value, 'f', -1, 64),
+		record.Unit,
+		record.SensorID,
+	})
+}
+
+func csvLine(fields []string) []byte {
+	var buffer bytes.Buffer
+	writer := csv.NewWriter(&buffer)
+	writer.Write(fields)
+	writer.Flush()
+	return buffer.Bytes()
+}
+
+// ReadFile reads the records of a recording of an airport in any format, compressed
+// or not.
+func ReadFile(filename string, airport string) ([]Record, error) {
+	if filepath.Ext(filename) == extensions[FormatParquet] {
+		return ReadParquet(filename)
+	}
+
+	file, err := Open(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	return Read(file, airport)
+}
+
+// Read reads CSV records when the input starts with the CSV header, JSON Lines when it
+// starts with an object, and legacy lines otherwise. Legacy lines have no airport, it is
+// given by the caller.
+func Read(input io.Reader, airport string) ([]Record, error) {
+	reader := bufio.NewReader(input)
+	start, err := reader.Peek(len("airport,"))
+	if err == nil && string(start) == "airport," {
+		return readCSV(reader)
+	}
+	if err == nil && start[0] == '{' {
+		return readJSONLines(reader)
+	}
+	return readLegacy(reader, airport)
+}
+
+func readCSV(input io.Reader) ([]Record, error) {
+	reader := csv.NewReader(input)
+	reader.FieldsPerRecord = len(CSVHeader)
+
+	_, err := reader.Read()
+	if err != nil {
+		return nil, err
+	}
+
+	var records []Record
+	for {
+		fields, err := reader.Read()
+		if err == io.EOF {
+			return records, nil
+		}
+		if err != nil {
+			return records, err
+		}
+
+		timestamp, err := time.Parse(time.RFC3339, fields[1])
+		if err != nil {
+			return records, err
+		}
+		value, err := strconv.ParseFloat(fields[3], 64)
+		if err != nil {
+			return records, err
+		}
+
+		records = append(records, Record{
+			Airport:     fields[0],
+			Time:        timestamp,
+			Measurement: fields[2],
+			Value:       value,
+			Unit:        fields[4],
+			SensorID:    fields[5],
+		})
+	}
+}
+
+func readJSONLines(input io.Reader) ([]Record, error) {
+	var records []Record
+	decoder := json.NewDecoder(input)
+	for {
+		var record Record
+		err := decoder.Decode(&record)
+		if err == io.EOF {
+			return records, nil
+		}
+		if err != nil {
+			return records, err
+		}
+		records = append(records, record)
+	}
+}
+
+func readLegacy(input io.Reader, airport string) ([]Record, error) {
+	var records []Record
+	scanner := bufio.NewScanner(input)
+	for scanner.Scan() {
+		if strings.TrimSpace(scanner.Text()) == "" {
+			continue
+		}
+		record, err := ParsePayload(airport, scanner.Text())
+		if err != nil {
+			return records, err
+		}
+		records = append(records, record)
+	}
+	return records, scanner.Err()
+}
@@ -0,0 +1,315 @@
+package recordings
+
+import (
+	"bytes"
+	"github.com/xitongsys/parquet-go-source/local"
+	parquetreader "github.com/xitongsys/parquet-go/reader"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+var testRecord = Record{
+	Airport:     "MRS",
+	Time:        time.Date(2024, 1, 19, 10, 0, 0, 0, SensorZone),
+	Measurement: "temperature",
+	Value:       285.15,
+	Unit:        "K",
+	SensorID:    "temperature_sensor_mrs",
+}
+
+func TestCSVFormat(t *testing.T) {
+	var buffer bytes.Buffer
+	buffer.Write(Header(FormatCSV))
+	buffer.Write(Format(FormatCSV, testRecord))
+
+	expected := "airport,timestamp,measurement,value,unit,sensor_id\nMRS,2024-01-19T10:00:00+01:00,temperature,285.15,K,temperature_sensor_mrs\n"
+	if buffer.String() != expected {
+		t.Fatalf("unexpected CSV:\n%s", buffer.String())
+	}
+
+	records, err := Read(&buffer, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(records) != 1 || !records[0].Time.Equal(testRecord.Time) || records[0].Value != testRecord.Value || records[0].SensorID != testRecord.SensorID {
+		t.Errorf("unexpected records: %+v", records)
+	}
+}
+
+func TestLegacyFormat(t *testing.T) {
+	line := Format(FormatLegacy, testRecord)
+	if string(line) != "2024-01-19 10:00:00 temperature 285.150000\n" || Header(FormatLegacy) != nil {
+		t.Fatalf("unexpected legacy line: %q", line)
+	}
+
+	records, err := Read(bytes.NewReader(line), "MRS")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(records) != 1 || records[0].Airport != "MRS" || !records[0].Time.Equal(testRecord.Time) {
+		t.Errorf("unexpected records: %+v", records)
+	}
+}
+
+func TestCompressFile(t *testing.T) {
+	for _, method := range []string{CompressionGzip, CompressionZstd} {
+		path := filepath.Join(t.TempDir(), "MRS_2024-01-19.csv")
+		os.WriteFile(path, append(Header(FormatCSV), Format(FormatCSV, testRecord)...), 0644)
+
+		compressed, err := CompressFile(path, method)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := os.Stat(path); !os.IsNotExist(err) {
+			t.Errorf("%s: original file kept", method)
+		}
+
+		records, err := ReadFile(compressed, "MRS")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(records) != 1 || !records[0].Time.Equal(testRecord.Time) || records[0].SensorID != testRecord.SensorID {
+			t.Errorf("%s: unexpected records %+v", method, records)
+		}
+	}
+}
+
+func TestJSONLinesFormat(t *testing.T) {
+	records, err := Read(bytes.NewReader(Format(FormatJSONLines, testRecord)), "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(records) != 1 || !records[0].Time.Equal(testRecord.Time) || records[0].SensorID != testRecord.SensorID || records[0].Value != testRecord.Value {
+		t.Errorf("unexpected records %+v", records)
+	}
+}
+
+func TestParquetReopen(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "MRS_2024-01-19.parquet")
+	for i := 0; i < 2; i++ {
+		writer, err := OpenWriter(path, FormatParquet, CompressionGzip)
+		if err != nil {
+			t.Fatal(err)
+		}
+		writer.Write(testRecord)
+		err = writer.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	records, err := ReadFile(path, "MRS")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(records) != 2 || records[1].Airport != "MRS" || records[1].Measurement != "temperature" || records[1].Value != testRecord.Value {
+		t.Errorf("unexpected records %+v", records)
+	}
+}
+
+// parquetRow is the schema of a Parquet recording for the parquet-go reader.
+type parquetRow struct {
+	Airport     string  `parquet:"name=airport, type=BYTE_ARRAY, convertedtype=UTF8"`
+	Timestamp   int64   `parquet:"name=timestamp, type=INT64, convertedtype=TIMESTAMP_MILLIS"`
+	Measurement string  `parquet:"name=measurement, type=BYTE_ARRAY, convertedtype=UTF8"`
+	Value       float64 `parquet:"name=value, type=DOUBLE"`
+	Unit        string  `parquet:"name=unit, type=BYTE_ARRAY, convertedtype=UTF8"`
+	SensorID    string  `parquet:"name=sensor_id, type=BYTE_ARRAY, convertedtype=UTF8"`
+}
+
+func TestCompactParquet(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "MRS_2024-01-19.parquet")
+	writer, err := OpenWriter(path, FormatParquet, CompressionZstd)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 3; i++ {
+		record := testRecord
+		record.Time = record.Time.Add(time.Duration(i) * time.Hour)
+		record.Value += float64(i)
+		writer.Write(record)
+	}
+	writer.Close()
+
+	before, _ := os.Stat(path)
+	compacted, err := CompactParquet(path)
+	if err != nil || !compacted {
+		t.Fatalf("file with 3 footers not compacted: %v", err)
+	}
+	after, _ := os.Stat(path)
+	if after.Size() >= before.Size() {
+		t.Errorf("compacted file of %d bytes, %d before", after.Size(), before.Size())
+	}
+	if compacted, err := CompactParquet(path); err != nil || compacted {
+		t.Errorf("compact file compacted again: %v", err)
+	}
+
+	// The row groups follow each other with nothing left between them
+	file, err := local.NewLocalFileReader(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+	reader, err := parquetreader.NewParquetReader(file, new(parquetRow), 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer reader.ReadStop()
+	offset := int64(len(parquetMagic))
+	for _, group := range reader.Footer.RowGroups {
+		for _, chunk := range group.Columns {
+			if chunk.MetaData.DataPageOffset != offset {
+				t.Fatalf("column chunk at %d, expected at %d", chunk.MetaData.DataPageOffset, offset)
+			}
+			offset += chunk.MetaData.TotalCompressedSize
+		}
+	}
+
+	rows := make([]parquetRow, reader.GetNumRows())
+	err = reader.Read(&rows)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rows) != 3 {
+		t.Fatalf("expected 3 rows, got %d", len(rows))
+	}
+	for i, row := range rows {
+		if row.Airport != "MRS" || row.Measurement != "temperature" || row.Value != testRecord.Value+float64(i) || row.SensorID != testRecord.SensorID || row.Timestamp != testRecord.Time.Add(time.Duration(i)*time.Hour).UnixMilli() {
+			t.Errorf("unexpected row %d: %+v", i, row)
+		}
+	}
+}
+
+func TestLayout(t *testing.T) {
+	layout, err := NewLayout("{airport}/{measurement}/{yyyy}/{MM}/{dd}.csv", true, FormatCSV)
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := layout.Path(testRecord, FormatCSV)
+	if path != filepath.FromSlash("airport=MRS/measurement=temperature/year=2024/month=01/19.csv") {
+		t.Errorf("unexpected path %s", path)
+	}
+
+	partition, ok := layout.Match(PartPath(path, 2) + ".gz")
+	if !ok || partition.Airport != "MRS" || partition.Measurement != "temperature" || !partition.Day.Equal(time.Date(2024, 1, 19, 0, 0, 0, 0, SensorZone)) {
+		t.Errorf("unexpected partition %+v of a compressed part", partition)
+	}
+	if _, ok := layout.Match("airport=MRS/notes.txt"); ok {
+		t.Errorf("file outside of the layout matched")
+	}
+
+	_, err = NewLayout("{airport}/{dd}.csv", false, FormatCSV)
+	if err == nil {
+		t.Errorf("template without year and month accepted")
+	}
+	_, err = NewLayout("{airport}_{yyyy}-{MM}-{dd}.csv", false, FormatParquet)
+	if err == nil {
+		t.Errorf("csv extension accepted for parquet files")
+	}
+
+	flat, _ := NewLayout("", false, FormatParquet)
+	if path := flat.Path(testRecord, FormatParquet); path != "MRS_2024-01-19.parquet" {
+		t.Errorf("unexpected flat path %s", path)
+	}
+}
+
+func TestFindDays(t *testing.T) {
+	dir := t.TempDir()
+	for _, name := range []string{"MRS_2024-01-18.csv", "MRS_2024-01-19.csv", "MRS_2024-01-19.1.csv.gz", "MRS_2024-01-20.csv", "LYS_2024-01-19.csv"} {
+		os.WriteFile(filepath.Join(dir, name), nil, 0644)
+	}
+	layout, _ := NewLayout("", false, "")
+
+	day := time.Date(2024, 1, 19, 0, 0, 0, 0, SensorZone)
+	files, err := Find(dir, layout, day, day.AddDate(0, 0, 1), []string{"MRS"})
+	if err != nil || len(files) != 2 || filepath.Base(files[0].Path) != "MRS_2024-01-19.1.csv.gz" || filepath.Base(files[1].Path) != "MRS_2024-01-19.csv" {
+		t.Errorf("expected the 2 files of MRS on the 19th, got %v (%v)", files, err)
+	}
+
+	// A range starting during a day includes its file
+	files, _ = Find(dir, layout, day.Add(12*time.Hour), day.AddDate(0, 0, 1), nil)
+	if len(files) != 3 {
+		t.Errorf("expected the 3 files of the 19th, got %v", files)
+	}
+}
+
+func TestRepairTornLine(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "MRS_2024-01-19.csv")
+	complete := append(Header(FormatCSV), Format(FormatCSV, testRecord)...)
+	os.WriteFile(path, append(complete, "MRS,2024-01-19T10:01"...), 0644)
+
+	torn, err := Repair(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, _ := os.ReadFile(path)
+	quarantined, _ := os.ReadFile(path + TornExtension)
+	if torn != int64(len("MRS,2024-01-19T10:01")) || string(data) != string(complete) || string(quarantined) != "MRS,2024-01-19T10:01" {
+		t.Errorf("unexpected repair of %d bytes:\n%s\nquarantined: %q", torn, data, quarantined)
+	}
+
+	torn, err = Repair(path)
+	if err != nil || torn != 0 {
+		t.Errorf("complete file repaired again: %d bytes, %v", torn, err)
+	}
+}
+
+func TestRepairTornParquet(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "MRS_2024-01-19.parquet")
+	writer, err := OpenWriter(path, FormatParquet, CompressionNone)
+	if err != nil {
+		t.Fatal(err)
+	}
+	writer.Write(testRecord)
+	next := testRecord
+	next.Time = next.Time.Add(time.Hour)
+	writer.Write(next)
+	writer.Close()
+
+	// A crash while appending the second row group after the first footer
+	data, _ := os.ReadFile(path)
+	firstFooter := writer.(*parquetWriter).rowGroups[1].columns[0].offset
+	os.WriteFile(path, data[:firstFooter+20], 0644)
+
+	_, err = Repair(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	records, err := ReadFile(path, "MRS")
+	if err != nil || len(records) != 1 {
+		t.Fatalf("expected the first row group after the repair, got %d records (%v)", len(records), err)
+	}
+
+	writer, err = OpenWriter(path, FormatParquet, CompressionNone)
+	if err != nil {
+		t.Fatal(err)
+	}
+	writer.Write(next)
+	writer.Close()
+	records, _ = ReadFile(path, "MRS")
+	if len(records) != 2 {
+		t.Errorf("expected 2 records after reopening the repaired file, got %d", len(records))
+	}
+}
+
+func TestChecksum(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "MRS_2024-01-19.csv")
+	os.WriteFile(path, Format(FormatCSV, testRecord), 0644)
+
+	err := WriteChecksum(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = VerifyChecksum(path)
+	if err != nil {
+		t.Errorf("checksum of an unchanged file: %v", err)
+	}
+
+	os.WriteFile(path, Format(FormatLegacy, testRecord), 0644)
+	err = VerifyChecksum(path)
+	if err == nil {
+		t.Errorf("modified file verified")
+	}
+}
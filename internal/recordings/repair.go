@@ -0,0 +1,144 @@
+package recordings
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+	"os"
+	"path/filepath"
+)
+
+// TornExtension is added to a recording for the file holding the bytes cut from its end.
+const TornExtension = ".torn"
+
+// Repair cuts the end of a recording left incomplete by a crash: the partial last line
+// of the line based formats, or what follows the last complete footer of a Parquet file.
+// The cut bytes are appended to the quarantine file next to the recording, and their
+// count is returned. Compressed recordings were complete when compressed and are left
+// alone.
+func Repair(path string) (int64, error) {
+	if IsCompressed(path) {
+		return 0, nil
+	}
+
+	file, err := os.OpenFile(path, os.O_RDWR, 0)
+	if err != nil {
+		return 0, err
+	}
+	defer file.Close()
+
+	info, err := file.Stat()
+	if err != nil || info.Size() == 0 {
+		return 0, err
+	}
+
+	var end int64
+	if filepath.Ext(path) == extensions[FormatParquet] {
+		end, err = parquetEnd(file, info.Size())
+	} else {
+		end, err = linesEnd(file, info.Size())
+	}
+	if err != nil || end == info.Size() {
+		return 0, err
+	}
+
+	torn := make([]byte, info.Size()-end)
+	_, err = file.ReadAt(torn, end)
+	if err != nil {
+		return 0, err
+	}
+	err = quarantine(path+TornExtension, torn)
+	if err != nil {
+		return 0, err
+	}
+
+	err = file.Truncate(end)
+	if err == nil {
+		err = file.Sync()
+	}
+	return int64(len(torn)), err
+}
+
+func quarantine(path string, data []byte) error {
+	file, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	_, err = file.Write(data)
+	if err == nil {
+		err = file.Sync()
+	}
+	closeErr := file.Close()
+	if err != nil {
+		return err
+	}
+	return closeErr
+}
+
+// linesEnd returns the offset following the last newline of a file.
+func linesEnd(file io.ReaderAt, size int64) (int64, error) {
+	buffer := make([]byte, 4096)
+	for end := size; end > 0; {
+		start := max(end-int64(len(buffer)), 0)
+		chunk := buffer[:end-start]
+		_, err := file.ReadAt(chunk, start)
+		if err != nil {
+			return 0, err
+		}
+		if i := bytes.LastIndexByte(chunk, '\n'); i >= 0 {
+			return start + int64(i) + 1, nil
+		}
+		end = start
+	}
+	return 0, nil
+}
+
+// parquetEnd returns the end of the last footer of a Parquet file whose row groups are
+// all complete, or the end of the leading magic when there is none.
+func parquetEnd(file io.ReaderAt, size int64) (int64, error) {
+	data := make([]byte, size)
+	_, err := file.ReadAt(data, 0)
+	if err != nil {
+		return 0, err
+	}
+	if len(data) < len(parquetMagic) && bytes.HasPrefix([]byte(parquetMagic), data) {
+		return 0, nil
+	}
+	if !bytes.HasPrefix(data, []byte(parquetMagic)) {
+		return 0, errParquet
+	}
+
+	magic := []byte(parquetMagic)
+	search := data
+	for {
+		i := bytes.LastIndex(search, magic)
+		if i < len(magic) {
+			// Only the leading magic is left
+			return int64(len(magic)), nil
+		}
+
+		end := int64(i + len(magic))
+		if end >= int64(8+len(magic)) {
+			footerStart := end - 8 - int64(binary.LittleEndian.Uint32(data[end-8:]))
+			if footerStart >= int64(len(magic)) && completeRowGroups(bytes.NewReader(data[:end]), end, footerStart) {
+				return end, nil
+			}
+		}
+		search = data[:i+len(magic)-1]
+	}
+}
+
+func completeRowGroups(file io.ReaderAt, size int64, footerStart int64) bool {
+	rowGroups, _, err := readParquetFooter(file, size)
+	if err != nil {
+		return false
+	}
+	for _, group := range rowGroups {
+		for _, chunk := range group.columns {
+			if chunk.offset < int64(len(parquetMagic)) || chunk.offset+chunk.compressedSize > footerStart {
+				return false
+			}
+		}
+	}
+	return true
+}
@@ -0,0 +1,242 @@
+package recordings
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"math"
+)
+
+// Parquet metadata is serialized with the Thrift compact protocol, only the parts used by
+// the Parquet footer and page headers are implemented.
+
+const (
+	thriftTrue   = 1
+	thriftFalse  = 2
+	thriftByte   = 3
+	thriftI16    = 4
+	thriftI32    = 5
+	thriftI64    = 6
+	thriftDouble = 7
+	thriftBinary = 8
+	thriftList   = 9
+	thriftSet    = 10
+	thriftMap    = 11
+	thriftStruct = 12
+)
+
+var errThrift = errors.New("invalid thrift data")
+
+type thriftWriter struct {
+	buffer bytes.Buffer
+	// Last field id of each open struct, field headers are deltas
+	fields []int16
+}
+
+func (w *thriftWriter) beginStruct() {
+	w.fields = append(w.fields, 0)
+}
+
+func (w *thriftWriter) endStruct() {
+	w.buffer.WriteByte(0)
+	w.fields = w.fields[:len(w.fields)-1]
+}
+
+func (w *thriftWriter) fieldHeader(id int16, fieldType byte) {
+	last := &w.fields[len(w.fields)-1]
+	delta := id - *last
+	if delta > 0 && delta <= 15 {
+		w.buffer.WriteByte(byte(delta)<<4 | fieldType)
+	} else {
+		w.buffer.WriteByte(fieldType)
+		w.varint(int64(id))
+	}
+	*last = id
+}
+
+func (w *thriftWriter) varint(value int64) {
+	w.buffer.Write(binary.AppendVarint(nil, value))
+}
+
+func (w *thriftWriter) i32(id int16, value int32) {
+	w.fieldHeader(id, thriftI32)
+	w.varint(int64(value))
+}
+
+func (w *thriftWriter) i64(id int16, value int64) {
+	w.fieldHeader(id, thriftI64)
+	w.varint(value)
+}
+
+func (w *thriftWriter) binary(id int16, value string) {
+	w.fieldHeader(id, thriftBinary)
+	w.bytes(value)
+}
+
+func (w *thriftWriter) bytes(value string) {
+	w.buffer.Write(binary.AppendUvarint(nil, uint64(len(value))))
+	w.buffer.WriteString(value)
+}
+
+func (w *thriftWriter) list(id int16, elementType byte, size int) {
+	w.fieldHeader(id, thriftList)
+	if size < 15 {
+		w.buffer.WriteByte(byte(size)<<4 | elementType)
+		return
+	}
+	w.buffer.WriteByte(0xf0 | elementType)
+	w.buffer.Write(binary.AppendUvarint(nil, uint64(size)))
+}
+
+func (w *thriftWriter) structField(id int16) {
+	w.fieldHeader(id, thriftStruct)
+	w.beginStruct()
+}
+
+// thriftFields holds the decoded fields of a struct by id: int64 for the integers, bool,
+// float64, []byte, []interface{} for lists and sets, and thriftFields.
+type thriftFields map[int16]interface{}
+
+func (s thriftFields) int(id int16) int64 {
+	value, _ := s[id].(int64)
+	return value
+}
+
+func (s thriftFields) string(id int16) string {
+	value, _ := s[id].([]byte)
+	return string(value)
+}
+
+func (s thriftFields) list(id int16) []interface{} {
+	value, _ := s[id].([]interface{})
+	return value
+}
+
+func (s thriftFields) structure(id int16) thriftFields {
+	value, _ := s[id].(thriftFields)
+	return value
+}
+
+type thriftReader struct {
+	*bytes.Reader
+}
+
+func (r thriftReader) readStruct() (thriftFields, error) {
+	fields := make(thriftFields)
+	var last int16
+	for {
+		header, err := r.ReadByte()
+		if err != nil {
+			return nil, err
+		}
+		if header == 0 {
+			return fields, nil
+		}
+
+		id := last + int16(header>>4)
+		if header>>4 == 0 {
+			value, err := binary.ReadVarint(r)
+			if err != nil {
+				return nil, err
+			}
+			id = int16(value)
+		}
+		last = id
+
+		fieldType := header & 0x0f
+		switch fieldType {
+		case thriftTrue:
+			fields[id] = true
+		case thriftFalse:
+			fields[id] = false
+		default:
+			fields[id], err = r.readValue(fieldType)
+			if err != nil {
+				return nil, err
+			}
+		}
+	}
+}
+
+func (r thriftReader) readValue(valueType byte) (interface{}, error) {
+	switch valueType {
+	case thriftTrue, thriftFalse:
+		value, err := r.ReadByte()
+		return value == thriftTrue, err
+	case thriftByte:
+		value, err := r.ReadByte()
+		return int64(int8(value)), err
+	case thriftI16, thriftI32, thriftI64:
+		return binary.ReadVarint(r)
+	case thriftDouble:
+		var value [8]byte
+		_, err := r.Read(value[:])
+		return math.Float64frombits(binary.LittleEndian.Uint64(value[:])), err
+	case thriftBinary:
+		size, err := r.readSize()
+		if err != nil {
+			return nil, err
+		}
+		value := make([]byte, size)
+		_, err = r.Read(value)
+		return value, err
+	case thriftList, thriftSet:
+		header, err := r.ReadByte()
+		if err != nil {
+			return nil, err
+		}
+		size := int(header >> 4)
+		if size == 15 {
+			size, err = r.readSize()
+			if err != nil {
+				return nil, err
+			}
+		}
+		values := make([]interface{}, 0, size)
+		for i := 0; i < size; i++ {
+			value, err := r.readValue(header & 0x0f)
+			if err != nil {
+				return nil, err
+			}
+			values = append(values, value)
+		}
+		return values, nil
+	case thriftMap:
+		size, err := r.readSize()
+		if err != nil || size == 0 {
+			return nil, err
+		}
+		types, err := r.ReadByte()
+		if err != nil {
+			return nil, err
+		}
+		for i := 0; i < 2*size; i++ {
+			valueType := types >> 4
+			if i%2 == 1 {
+				valueType = types & 0x0f
+			}
+			_, err := r.readValue(valueType)
+			if err != nil {
+				return nil, err
+			}
+		}
+		return nil, nil
+	case thriftStruct:
+		return r.readStruct()
+	default:
+		return nil, errThrift
+	}
+}
+
+// readSize reads the size of a collection, bounded by the remaining data so that corrupt
+// input cannot allocate more than the file.
+func (r thriftReader) readSize() (int, error) {
+	size, err := binary.ReadUvarint(r)
+	if err != nil {
+		return 0, err
+	}
+	if size > uint64(r.Len()) {
+		return 0, errThrift
+	}
+	return int(size), nil
+}
@@ -0,0 +1,88 @@
+package recordings
+
+import (
+	"bufio"
+	"os"
+	"time"
+)
+
+// A Writer appends records to an open recording.
+type Writer interface {
+	Write(record Record) error
+	// Sync writes the buffered records that are due and syncs the file to disk
+	Sync(now time.Time) error
+	// Size returns the size of the file on disk
+	Size() int64
+	Close() error
+}
+
+// OpenWriter opens a recording for appending in a format. Parquet pages are compressed
+// with the compression method, the line based files are compressed once complete.
+func OpenWriter(path string, format string, compression string) (Writer, error) {
+	if format == FormatParquet {
+		return openParquet(path, compression)
+	}
+	return openLines(path, format)
+}
+
+// lineWriter writes the line based formats through a buffer, a new file starts with the
+// header of the format.
+type lineWriter struct {
+	file   *os.File
+	writer *bufio.Writer
+	format string
+	size   int64
+}
+
+func openLines(path string, format string) (*lineWriter, error) {
+	file, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return nil, err
+	}
+	w := &lineWriter{file: file, writer: bufio.NewWriter(file), format: format}
+
+	info, err := file.Stat()
+	if err == nil {
+		w.size = info.Size()
+	}
+	if err == nil && w.size == 0 {
+		_, err = w.write(Header(format))
+	}
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+	return w, nil
+}
+
+func (w *lineWriter) write(line []byte) (int, error) {
+	n, err := w.writer.Write(line)
+	w.size += int64(n)
+	return n, err
+}
+
+func (w *lineWriter) Write(record Record) error {
+	_, err := w.write(Format(w.format, record))
+	return err
+}
+
+func (w *lineWriter) Sync(time.Time) error {
+	err := w.writer.Flush()
+	if err != nil {
+		return err
+	}
+	return w.file.Sync()
+}
+
+func (w *lineWriter) Size() int64 {
+	return w.size
+}
+
+func (w *lineWriter) Close() error {
+	err := w.Sync(time.Time{})
+	closeErr := w.file.Close()
+	if err != nil {
+		return err
+	}
+	return closeErr
+}
@@ -7,6 +7,7 @@ import (
 	"gopkg.in/yaml.v3"
 	"log"
 	"os"
+	"strings"
 	"sync"
 	"time"
 )
@@ -68,6 +69,25 @@ func LoadSensorConfigs(filename string) (RetrievedSensorsConfig, error) {
 	return configs, nil
 }
 
+// Measurement returns the measurement published by a sensor, taken from its client ID
+// prefix such as "pressure" for "pressure_sensor_mrs".
+func (info SensorInfo) Measurement() string {
+	index := strings.Index(info.ClientID, "_sensor")
+	if index < 0 {
+		return ""
+	}
+	return info.ClientID[:index]
+}
+
+// Units of the measurements published by the sensors.
+var Units = map[string]string{
+	"temperature":    "K",
+	"pressure":       "hPa",
+	"wind":           "m/s",
+	"wind_direction": "deg",
+	"humidity":       "%",
+}
+
 func NewSensor(client *mqttconnect.Client, qos byte, retained bool, config SensorConfig, info SensorInfo) *Sensor {
 	return &Sensor{
 		client:   client,
@@ -0,0 +1,29 @@
+package thresholds
+
+// Bounds is the band a reading must stay within.
+type Bounds struct {
+	Min float64 `yaml:"min"`
+	Max float64 `yaml:"max"`
+}
+
+// SeasonalBounds holds optional default bounds and per-season bounds keyed by the
+// season names of the airport calendars. It is the layout of the temp and pressure
+// keys of threshold_config.yml.
+type SeasonalBounds struct {
+	Min      *float64          `yaml:"min,omitempty"`
+	Max      *float64          `yaml:"max,omitempty"`
+	Severity string            `yaml:"severity"`
+	Seasons  map[string]Bounds `yaml:",inline"`
+}
+
+// ForSeason returns the bounds of a season, or the default bounds when the season has
+// none.
+func (bounds SeasonalBounds) ForSeason(season string) (Bounds, bool) {
+	if seasonBounds, ok := bounds.Seasons[season]; ok {
+		return seasonBounds, true
+	}
+	if bounds.Min != nil && bounds.Max != nil {
+		return Bounds{Min: *bounds.Min, Max: *bounds.Max}, true
+	}
+	return Bounds{}, false
+}
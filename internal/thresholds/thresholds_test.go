@@ -0,0 +1,37 @@
+package thresholds
+
+import (
+	"gopkg.in/yaml.v3"
+	"strings"
+	"testing"
+)
+
+func TestForSeason(t *testing.T) {
+	var bounds SeasonalBounds
+	err := yaml.Unmarshal([]byte("severity: warning\nmin: 260\nmax: 310\nsummer:\n  min: 280\n  max: 315\n"), &bounds)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if summer, ok := bounds.ForSeason("summer"); !ok || summer != (Bounds{Min: 280, Max: 315}) {
+		t.Errorf("unexpected summer bounds: %+v", summer)
+	}
+	if winter, ok := bounds.ForSeason("winter"); !ok || winter != (Bounds{Min: 260, Max: 310}) {
+		t.Errorf("unexpected default bounds: %+v", winter)
+	}
+
+	bounds.Min = nil
+	if _, ok := bounds.ForSeason("winter"); ok {
+		t.Error("season without bounds nor complete defaults has bounds")
+	}
+}
+
+func TestSeasonalBoundsWithoutDefaults(t *testing.T) {
+	output, err := yaml.Marshal(SeasonalBounds{Severity: "warning", Seasons: map[string]Bounds{"summer": {Min: 280, Max: 315}}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(output), "null") {
+		t.Errorf("missing default bounds written:\n%s", output)
+	}
+}